@@ -25,7 +25,10 @@ import (
 func Sync(lg *slog.Logger, vdb storage.VectorDB, embed llm.Embedder, dc *docs.Corpus) {
 	lg.Info("embeddocs sync")
 
-	const batchSize = 100
+	// Embedders split large batches into requests of their own size
+	// (100 documents for Gemini), which they may send concurrently,
+	// so batchSize is a multiple of that size.
+	const batchSize = 1000
 	var (
 		batch     []llm.EmbedDoc
 		ids       []string
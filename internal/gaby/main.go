@@ -98,9 +98,12 @@
 //
 // Gaby needs to manage a few secret keys used to access services.
 // The [golang.org/x/oscar/internal/secret] package defines the interface for
-// obtaining those secrets. The only implementations at the moment
-// are an in-memory map and a disk-based implementation that reads
-// $HOME/.netrc. Future implementations may include other file formats
+// obtaining those secrets. The implementations at the moment
+// are an in-memory map, a disk-based implementation that reads
+// $HOME/.netrc, and [secret.Dir], which reads each secret from its own
+// file in a directory, as used by secret mounts in container deployments.
+// Gaby uses $HOME/.netrc by default, or [secret.Dir] when the -secret-dir
+// flag is set. Future implementations may include other file formats
 // as well as cloud-based secret storage services.
 //
 // Secret storage is intentionally separated from the main database storage,
@@ -312,10 +315,13 @@
 // # Main Loop
 //
 // All of these pieces are put together in the main program, this package, [golang.org/x/oscar].
-// The actual main package has no tests yet but is also incredibly straightforward.
-// It does need tests, but we also need to identify ways that the hard-coded policies
+// The main package is straightforward, and its tests cover the pieces that are
+// more than glue: the webhook and health handlers, flag parsing, and a full round
+// of work on sample issues (see the -sample flag).
+// We also need to identify ways that the hard-coded policies
 // in the package can be lifted out into data that a natural language interface can
-// manipulate. For example the current policy choices in package main amount to:
+// manipulate. For example the current policy choices in package main
+// (see the policies function) amount to:
 //
 //	cf := commentfix.New(lg, gh, "gerritlinks")
 //	cf.EnableProject("golang/go")
@@ -350,9 +356,11 @@
 // version of that.
 //
 // Another important area of future work will be running Gaby on top of cloud databases
-// and then moving Gaby's own execution into the cloud. Getting it a server with a URL will
-// enable GitHub callbacks instead of the current 2-minute polling loop, which will enable
-// interactive conversations with Gaby.
+// and then moving Gaby's own execution into the cloud.
+// Gaby already accepts GitHub webhook deliveries when given a server with a URL
+// (see the -webhook-addr flag), which wake the main loop as soon as an issue changes,
+// with polling (every 2 minutes by default; see -poll) as a fallback.
+// Building on that to enable interactive conversations with Gaby is future work.
 //
 // Overall, we believe that there are a few good ideas for ways that LLM-based bots can help
 // make project maintainers' jobs easier and less monotonous, and they are waiting to be found.
@@ -369,13 +377,24 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"golang.org/x/oscar/internal/commentfix"
@@ -391,38 +410,116 @@ import (
 	"golang.org/x/oscar/internal/storage"
 )
 
-var searchMode = flag.Bool("search", false, "run in interactive search mode")
+var (
+	searchMode  = flag.Bool("search", false, "run in interactive search mode")
+	verbose     = flag.Bool("verbose", false, "log debugging details")
+	healthAddr  = flag.String("health-addr", "", "serve /healthz and /readyz health checks on `addr`")
+	webhookAddr = flag.String("webhook-addr", "", "serve GitHub webhook deliveries at /webhook on `addr`")
+	pollEvery   = flag.Duration("poll", 2*time.Minute, "check GitHub for new activity every `interval`")
+	secretDir   = flag.String("secret-dir", "", "read secrets from files in `dir` instead of $HOME/.netrc")
+	sample      = flag.String("sample", "", "use the sample issues in the txtar `file` instead of GitHub, logging edits instead of making them; name the sample's projects in -projects and use an early -since (for example, -sample internal/testdata/rsctmp.txt -projects rsc/tmp -since 2015-01-01); Gemini is still used, so a Gemini key is required")
+	since       = flag.String("since", "", "only fix and post to issues changed or created since `time`, a duration before now (such as 24h) or a date (such as 2024-06-01 or an RFC 3339 time)")
+	proxy       = flag.String("proxy", "", "send GitHub and Gemini requests through the HTTP proxy at `url` (default from $HTTPS_PROXY)")
+	caCert      = flag.String("ca-cert", "", "trust the PEM certificates in `file` as well as the system roots, for TLS to GitHub and Gemini")
+	strict      = flag.Bool("strict", false, "exit if syncing with GitHub fails, instead of logging the error and trying again next round")
+	projects    = flag.String("projects", "golang/go", "fix and post to issues in the comma-separated list of GitHub `projects`")
+	embedConc   = flag.Int("embed-concurrency", 1, "send up to `n` Gemini embedding requests at once")
+	webhookWait = flag.Duration("webhook-wait", 10*time.Second, "wait `duration` after a webhook delivery for more changes to the same issue")
+)
 
 func main() {
 	flag.Parse()
 
-	lg := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	// Log to standard error, so that the only output on standard output
+	// is meant for the user (for example, search results).
+	// Debug logs are very chatty, so only print them in verbose mode.
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	lg := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	// Cancel in-flight work, such as GitHub sync requests,
+	// on interrupt or termination.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var sinceTime time.Time
+	if *since != "" {
+		t, err := parseSince(*since, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinceTime = t
+	}
 
-	sdb := secret.Netrc()
+	projectList := splitProjects(*projects)
+	if len(projectList) == 0 {
+		log.Fatalf("invalid -projects %q: no projects listed", *projects)
+	}
+
+	var sdb secret.DB = secret.Netrc()
+	if *secretDir != "" {
+		sdb = secret.Dir(*secretDir)
+	}
+
+	var db storage.DB
+	if *sample != "" {
+		db = storage.MemDB()
+	} else {
+		var err error
+		db, err = pebble.Open(lg, "gaby.db")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	db, err := pebble.Open(lg, "gaby.db")
+	vdb := storage.MemVectorDB(db, lg, "")
+
+	hc, err := httpClient(*proxy, *caCert)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	vdb := storage.MemVectorDB(db, lg, "")
+	gh := github.New(lg, db, sdb, hc)
+	// Ran during setup, once for each of *projects: gh.Add("golang/go")
+	if *sample != "" {
+		// Serve issues from the sample file and divert all edits.
+		// No projects are added, so syncing does nothing.
+		if err := loadSample(gh, *sample); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	gh := github.New(lg, db, secret.Netrc(), http.DefaultClient)
-	// Ran during setup: gh.Add("golang/go")
+	if *sample == "" {
+		checkProjects(lg, gh, projectList)
+	}
 
 	dc := docs.New(db)
-	ai, err := gemini.NewClient(lg, sdb, http.DefaultClient)
+	ai, err := gemini.NewClient(lg, sdb, hc)
 	if err != nil {
 		log.Fatal(err)
 	}
+	ai.SetConcurrency(*embedConc)
 
+	// Check credentials now instead of discovering
+	// a bad or expired key in the middle of a run.
+	if err := ai.CheckKey(ctx); err != nil {
+		log.Fatal(err)
+	}
 	if *searchMode {
 		// Search loop.
 		data, err := io.ReadAll(os.Stdin)
 		if err != nil {
 			log.Fatal(err)
 		}
-		vecs, err := ai.EmbedDocs(context.Background(), []llm.EmbedDoc{{Title: "", Text: string(data)}})
+		vecs, err := ai.EmbedDocs(ctx, []llm.EmbedDoc{{Title: "", Text: string(data)}})
+		var q *gemini.QuotaExceededError
+		if errors.As(err, &q) {
+			if q.RetryDelay > 0 {
+				log.Fatalf("gemini quota exhausted; try again in %v", q.RetryDelay)
+			}
+			log.Fatalf("gemini quota exhausted; try again later (%s)", q.Quota)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -437,29 +534,366 @@ func main() {
 		return
 	}
 
-	gh.Sync()
+	// Search mode needs only Gemini and the vector database,
+	// so check GitHub credentials only now.
+	var login string
+	if *sample == "" {
+		login, err = gh.Login(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lg.Info("gaby github login", "login", login)
+	}
+
+	var ready atomic.Bool
+	if *healthAddr != "" {
+		go serveHealth(lg, *healthAddr, &ready)
+	}
+
+	wake := make(chan struct{}, 1)
+	if *webhookAddr != "" {
+		key, ok := sdb.Get("github.webhook")
+		if !ok {
+			log.Fatal("missing secret for github.webhook")
+		}
+		// If key is from .netrc, ignore user name.
+		if _, pass, ok := strings.Cut(key, ":"); ok {
+			key = pass
+		}
+		go serveWebhook(lg, *webhookAddr, []byte(key), *webhookWait, wake)
+	}
+
+	syncGitHub(ctx, lg, gh)
 	githubdocs.Sync(lg, dc, gh)
 	embeddocs.Sync(lg, vdb, ai, dc)
+	ready.Store(true)
 
+	cf, rp := policies(lg, db, gh, vdb, dc, projectList, sinceTime, login)
+	for round := 1; ; round++ {
+		runRound(ctx, round, lg, gh, dc, vdb, ai, cf, rp)
+		if *sample != "" {
+			for _, e := range gh.Testing().Edits() {
+				lg.Info("gaby sample edit", "edit", e.String())
+			}
+			gh.Testing().ClearEdits()
+		}
+		select {
+		case <-time.After(*pollEvery):
+		case <-wake:
+		case <-ctx.Done():
+			lg.Info("gaby exiting", "err", context.Cause(ctx))
+			return
+		}
+	}
+}
+
+// loadSample makes gh serve the sample issues in the txtar file
+// and divert all edits, for use with -sample.
+func loadSample(gh *github.Client, file string) error {
+	gh.EnableTesting()
+	return gh.Testing().LoadTxtar(file)
+}
+
+// policies returns the comment fixer and related-issue poster
+// that gaby runs on the given projects.
+// If since is not zero, they skip issues and comments older than since.
+// If login is not empty, it is gaby's own GitHub login,
+// whose issues the poster skips.
+func policies(lg *slog.Logger, db storage.DB, gh *github.Client, vdb storage.VectorDB, dc *docs.Corpus, projects []string, since time.Time, login string) (*commentfix.Fixer, *related.Poster) {
 	cf := commentfix.New(lg, gh, "gerritlinks")
-	cf.EnableProject("golang/go")
+	for _, p := range projects {
+		cf.EnableProject(p)
+	}
 	cf.EnableEdits()
+	if !since.IsZero() {
+		cf.SetTimeLimit(since)
+	}
 	cf.AutoLink(`\bCL ([0-9]+)\b`, "https://go.dev/cl/$1")
 	cf.ReplaceURL(`\Qhttps://go-review.git.corp.google.com/\E`, "https://go-review.googlesource.com/")
 
 	rp := related.New(lg, db, gh, vdb, dc, "related")
-	rp.EnableProject("golang/go")
+	for _, p := range projects {
+		rp.EnableProject(p)
+	}
 	rp.EnablePosts()
+	if !since.IsZero() {
+		rp.SetTimeLimit(since)
+	}
 	rp.SkipBodyContains("— [watchflakes](https://go.dev/wiki/Watchflakes)")
 	rp.SkipTitlePrefix("x/tools/gopls: release version v")
 	rp.SkipTitleSuffix(" backport]")
-	for {
-		gh.Sync()
-		githubdocs.Sync(lg, dc, gh)
-		embeddocs.Sync(lg, vdb, ai, dc)
-		cf.Run()
-		rp.Run()
-		time.Sleep(2 * time.Minute)
+	if login != "" {
+		rp.SkipAuthor(login) // never react to our own issues
+	}
+	return cf, rp
+}
+
+// runRound runs the given round of gaby's work:
+// it syncs GitHub, updates the documents and their embeddings,
+// and then runs the comment fixer and related-issue poster.
+func runRound(ctx context.Context, round int, lg *slog.Logger, gh *github.Client, dc *docs.Corpus, vdb storage.VectorDB, ai llm.Embedder, cf *commentfix.Fixer, rp *related.Poster) {
+	start := time.Now()
+	timeStage(lg, "github sync", func() { syncGitHub(ctx, lg, gh) })
+	timeStage(lg, "githubdocs sync", func() { githubdocs.Sync(lg, dc, gh) })
+	timeStage(lg, "embeddocs sync", func() { embeddocs.Sync(lg, vdb, ai, dc) })
+	timeStage(lg, "commentfix", func() { cf.Run(ctx) })
+	timeStage(lg, "related", func() { rp.Run(ctx) })
+	lg.Info("gaby round", "round", round, "elapsed", time.Since(start))
+}
+
+// splitProjects splits the -projects flag value s
+// into a list of projects, trimming spaces around each one
+// and skipping empty entries.
+func splitProjects(s string) []string {
+	var list []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// checkProjects logs a warning for each of projects
+// that has not been added to gh with [github.Client.Add],
+// since gaby never syncs those projects and so never acts on them.
+// It returns the missing projects.
+func checkProjects(lg *slog.Logger, gh *github.Client, projects []string) []string {
+	have := gh.Projects()
+	var missing []string
+	for _, p := range projects {
+		if !slices.Contains(have, p) {
+			lg.Warn("gaby project not added to github sync, so it will not be processed", "project", p)
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+// parseSince parses the -since flag value s,
+// which is either a non-negative duration before now or a date or time.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("invalid -since %q: negative duration", s)
+		}
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid -since %q: want duration (such as 24h), date (such as 2024-06-01), or RFC 3339 time", s)
+}
+
+// httpClient returns the HTTP client to use for GitHub and Gemini.
+// If proxy is non-empty, the client uses the proxy at that URL;
+// otherwise it uses the proxy from the environment, if any.
+// If caCert is non-empty, the client trusts the PEM certificates
+// in that file in addition to the system roots, as is needed
+// behind proxies that intercept TLS.
+func httpClient(proxy, caCert string) (*http.Client, error) {
+	if proxy == "" && caCert == "" {
+		return http.DefaultClient, nil
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -proxy: %v", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+// timeStage runs f, the named stage of a round of work,
+// and logs how long it took, to help find slow stages.
+func timeStage(lg *slog.Logger, name string, f func()) {
+	start := time.Now()
+	f()
+	lg.Info("gaby stage", "stage", name, "elapsed", time.Since(start))
+}
+
+// syncGitHub syncs gh with GitHub.
+// A failed sync is usually transient and is retried in the next round,
+// so syncGitHub only logs the error, unless -strict is set,
+// in which case it exits.
+func syncGitHub(ctx context.Context, lg *slog.Logger, gh *github.Client) {
+	if err := gh.Sync(ctx); err != nil {
+		if ctx.Err() != nil {
+			return // shutting down
+		}
+		if *strict {
+			log.Fatalf("github sync: %v", err)
+		}
+		lg.Error("gaby github sync", "err", err)
+	}
+}
+
+// serveHealth serves health checks on addr, for use by a process supervisor.
+// /healthz reports that the process is running.
+// /readyz reports whether ready has been set,
+// which main does once the initial sync is finished.
+func serveHealth(lg *slog.Logger, addr string, ready *atomic.Bool) {
+	lg.Info("gaby health server", "addr", addr)
+	log.Fatal(http.ListenAndServe(addr, healthMux(ready)))
+}
+
+// healthMux returns the handler for the health checks served by [serveHealth].
+func healthMux(ready *atomic.Bool) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "ok\n")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			http.Error(w, "initial sync not finished", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "ok\n")
+	})
+	return mux
+}
+
+// maxDeliveries is the number of webhook delivery IDs
+// serveWebhook remembers for discarding redeliveries.
+const maxDeliveries = 10000
+
+// serveWebhook serves GitHub webhook deliveries at /webhook on addr,
+// checking each delivery's signature using key.
+// A new or edited issue or issue comment wakes the main loop
+// by sending on wake, so that gaby syncs and runs the fixers and posters
+// right away instead of waiting for the next polling interval.
+// The handler responds immediately and does no GitHub work itself.
+// Wake has a buffer of one, so deliveries that arrive while a run
+// is already pending are folded into that run.
+//
+// A burst of edits to one issue sends a burst of deliveries,
+// so serveWebhook waits until an issue has had no new deliveries
+// for the given duration before waking the main loop,
+// which then sees only the issue's latest state.
+//
+// GitHub redelivers events it thinks were not received,
+// so serveWebhook ignores delivery IDs it has already seen.
+func serveWebhook(lg *slog.Logger, addr string, key []byte, wait time.Duration, wake chan<- struct{}) {
+	issues := newDebouncer(wait, func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle("POST /webhook", webhookHandler(lg, key, issues))
+	lg.Info("gaby webhook server", "addr", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// webhookHandler returns the handler for GitHub webhook deliveries
+// used by [serveWebhook]. It records an event in issues, keyed by
+// "owner/repo#number", for each new or edited issue or issue comment.
+func webhookHandler(lg *slog.Logger, key []byte, issues *debouncer) http.Handler {
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event, body, err := github.ValidateWebhookRequest(r, key)
+		if err != nil {
+			lg.Error("gaby webhook", "err", err)
+			http.Error(w, "invalid webhook request", http.StatusBadRequest)
+			return
+		}
+
+		// Deliveries without an ID cannot be matched to redeliveries,
+		// so they are always processed.
+		id := r.Header.Get("X-GitHub-Delivery")
+		dup := false
+		if id != "" {
+			mu.Lock()
+			dup = seen[id]
+			if len(seen) >= maxDeliveries {
+				clear(seen)
+			}
+			seen[id] = true
+			mu.Unlock()
+		}
+		if dup {
+			lg.Info("gaby webhook redelivery", "delivery", id)
+			return
+		}
+
+		var payload struct {
+			Action     string       `json:"action"`
+			Issue      github.Issue `json:"issue"`
+			Repository struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			lg.Error("gaby webhook json", "delivery", id, "err", err)
+			http.Error(w, "invalid webhook payload", http.StatusBadRequest)
+			return
+		}
+		switch event + " " + payload.Action {
+		default:
+			return
+		case "issues opened", "issues edited", "issue_comment created", "issue_comment edited":
+		}
+		lg.Info("gaby webhook", "event", event, "action", payload.Action, "project", payload.Repository.FullName, "issue", payload.Issue.Number, "delivery", id)
+		issues.event(fmt.Sprintf("%s#%d", payload.Repository.FullName, payload.Issue.Number))
+	})
+}
+
+// A debouncer calls a function once per burst of events with the same key,
+// after the key has had no events for a fixed delay.
+type debouncer struct {
+	delay time.Duration
+	f     func()
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// newDebouncer returns a new debouncer that calls f
+// delay after the last of a burst of events for a key.
+func newDebouncer(delay time.Duration, f func()) *debouncer {
+	return &debouncer{delay: delay, f: f, timers: make(map[string]*time.Timer)}
+}
+
+// event records an event for key,
+// postponing the call for any pending burst of events for key.
+func (d *debouncer) event(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t, ok := d.timers[key]; ok && t.Stop() {
+		t.Reset(d.delay)
+		return
 	}
-	return
+	var t *time.Timer
+	t = time.AfterFunc(d.delay, func() {
+		d.mu.Lock()
+		if d.timers[key] == t {
+			delete(d.timers, key)
+		}
+		d.mu.Unlock()
+		d.f()
+	})
+	d.timers[key] = t
 }
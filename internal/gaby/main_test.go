@@ -0,0 +1,340 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oscar/internal/docs"
+	"golang.org/x/oscar/internal/github"
+	"golang.org/x/oscar/internal/llm"
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+const testDelay = 50 * time.Millisecond
+
+// newTestDebouncer returns a debouncer with a short delay
+// that sends on the returned channel each time it fires.
+func newTestDebouncer() (*debouncer, <-chan struct{}) {
+	fired := make(chan struct{}, 10)
+	d := newDebouncer(testDelay, func() { fired <- struct{}{} })
+	return d, fired
+}
+
+// calls counts the calls reported on fired
+// until none has arrived for several delays.
+func calls(fired <-chan struct{}) int {
+	n := 0
+	for {
+		select {
+		case <-fired:
+			n++
+		case <-time.After(4 * testDelay):
+			return n
+		}
+	}
+}
+
+func TestDebouncerCoalesce(t *testing.T) {
+	d, fired := newTestDebouncer()
+	for range 5 {
+		d.event("golang/go#1")
+	}
+	if n := calls(fired); n != 1 {
+		t.Errorf("5 events for one key: %d calls, want 1", n)
+	}
+}
+
+func TestDebouncerKeys(t *testing.T) {
+	d, fired := newTestDebouncer()
+	d.event("golang/go#1")
+	d.event("golang/go#2")
+	d.event("golang/go#1")
+	if n := calls(fired); n != 2 {
+		t.Errorf("events for two keys: %d calls, want 2", n)
+	}
+}
+
+func TestDebouncerAfterFire(t *testing.T) {
+	d, fired := newTestDebouncer()
+	d.event("golang/go#1")
+	if n := calls(fired); n != 1 {
+		t.Fatalf("first event: %d calls, want 1", n)
+	}
+	// The burst is over, so a new event starts a new burst.
+	d.event("golang/go#1")
+	if n := calls(fired); n != 1 {
+		t.Errorf("event after firing: %d calls, want 1", n)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	key := []byte("secret")
+	d, fired := newTestDebouncer()
+	h := webhookHandler(testutil.Slogger(t), key, d)
+
+	// deliver sends a delivery to h and returns the response status.
+	deliver := func(event, id, payload string, sign bool) int {
+		r := httptest.NewRequest("POST", "/webhook", strings.NewReader(payload))
+		r.Header.Set("X-GitHub-Event", event)
+		if id != "" {
+			r.Header.Set("X-GitHub-Delivery", id)
+		}
+		mac := hmac.New(sha256.New, key)
+		if !sign {
+			mac = hmac.New(sha256.New, []byte("wrong"))
+		}
+		mac.Write([]byte(payload))
+		r.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	const (
+		opened1 = `{"action":"opened","issue":{"number":1},"repository":{"full_name":"rsc/tmp"}}`
+		opened2 = `{"action":"opened","issue":{"number":2},"repository":{"full_name":"rsc/tmp"}}`
+		closed3 = `{"action":"closed","issue":{"number":3},"repository":{"full_name":"rsc/tmp"}}`
+	)
+
+	for _, tt := range []struct {
+		name    string
+		event   string
+		id      string
+		payload string
+		sign    bool
+		code    int
+		calls   int
+	}{
+		{"valid", "issues", "d1", opened1, true, 200, 1},
+		{"bad signature", "issues", "d2", opened2, false, 400, 0},
+		{"redelivery", "issues", "d1", opened1, true, 200, 0},
+		{"new id", "issues", "d3", opened2, true, 200, 1},
+		{"no id", "issues", "", opened1, true, 200, 1},
+		{"no id again", "issues", "", opened1, true, 200, 1},
+		{"ignored action", "issues", "d4", closed3, true, 200, 0},
+		{"ignored event", "pull_request", "d5", opened2, true, 200, 0},
+		{"bad json", "issues", "d6", `{"action":`, true, 400, 0},
+	} {
+		if code := deliver(tt.event, tt.id, tt.payload, tt.sign); code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.name, code, tt.code)
+		}
+		if n := calls(fired); n != tt.calls {
+			t.Errorf("%s: %d calls, want %d", tt.name, n, tt.calls)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	var ready atomic.Bool
+	h := healthMux(&ready)
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200", code)
+	}
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before ready = %d, want 503", code)
+	}
+	ready.Store(true)
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz after ready = %d, want 200", code)
+	}
+}
+
+func TestCheckProjects(t *testing.T) {
+	lg, out := testutil.SlogBuffer()
+	gh := github.New(lg, storage.MemDB(), nil, nil)
+	testutil.Check(t, gh.Add("golang/go"))
+	testutil.Check(t, gh.Add("golang/tools"))
+
+	missing := checkProjects(lg, gh, []string{"golang/go", "golang/tools", "golang/vscode-go"})
+	if want := []string{"golang/vscode-go"}; !slices.Equal(missing, want) {
+		t.Errorf("checkProjects() = %q, want %q", missing, want)
+	}
+	if !strings.Contains(out.String(), "golang/vscode-go") {
+		t.Errorf("checkProjects did not log missing project:\n%s", out)
+	}
+}
+
+func TestSplitProjects(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		out []string
+	}{
+		{"golang/go", []string{"golang/go"}},
+		{"golang/go, golang/tools", []string{"golang/go", "golang/tools"}},
+		{" golang/go,,golang/tools ,", []string{"golang/go", "golang/tools"}},
+		{" , ", nil},
+	} {
+		if out := splitProjects(tt.in); !slices.Equal(out, tt.out) {
+			t.Errorf("splitProjects(%q) = %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+var parseSinceTests = []struct {
+	in  string
+	out string // RFC 3339, or "" for error
+}{
+	{"24h", "2024-06-09T12:00:00Z"},
+	{"90m", "2024-06-10T10:30:00Z"},
+	{"0s", "2024-06-10T12:00:00Z"},
+	{"2024-06-01", "2024-06-01T00:00:00Z"},
+	{"2024-06-01T15:04:05Z", "2024-06-01T15:04:05Z"},
+	{"2024-06-01T15:04:05-04:00", "2024-06-01T19:04:05Z"},
+	{"-24h", ""},
+	{"yesterday", ""},
+	{"2024-13-01", ""},
+	{"", ""},
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	for _, tt := range parseSinceTests {
+		out, err := parseSince(tt.in, now)
+		if tt.out == "" {
+			if err == nil {
+				t.Errorf("parseSince(%q) = %v, want error", tt.in, out)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSince(%q): %v", tt.in, err)
+			continue
+		}
+		if s := out.UTC().Format(time.RFC3339); s != tt.out {
+			t.Errorf("parseSince(%q) = %s, want %s", tt.in, s, tt.out)
+		}
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	const proxy = "http://proxy.example.com:3128"
+	c, err := httpClient(proxy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := c.Transport.(*http.Transport).Proxy(req)
+	if err != nil || u == nil || u.String() != proxy {
+		t.Errorf("Proxy(%s) = %v, %v, want %s", req.URL, u, err, proxy)
+	}
+}
+
+func TestHTTPClientCACert(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(file, []byte("not a certificate\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := httpClient("", file); err == nil {
+		t.Errorf("httpClient with no PEM data succeeded, want error")
+	}
+	if _, err := httpClient("", filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Errorf("httpClient with missing file succeeded, want error")
+	}
+
+	// A client trusting the test server's certificate can talk to it;
+	// the default client cannot.
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(file, pemData, 0666); err != nil {
+		t.Fatal(err)
+	}
+	c, err := httpClient("", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Transport.(*http.Transport).TLSClientConfig.RootCAs == nil {
+		t.Errorf("httpClient with -ca-cert did not set RootCAs")
+	}
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET with -ca-cert: %v", err)
+	}
+	resp.Body.Close()
+	if resp, err := http.DefaultClient.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Errorf("GET without -ca-cert succeeded, want certificate error")
+	}
+}
+
+// TestSample runs a round of gaby the way -sample does,
+// with a fake embedder in place of Gemini.
+func TestSample(t *testing.T) {
+	ctx := context.Background()
+	lg := testutil.Slogger(t)
+	since := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// sample runs the given rounds on the sample issues
+	// and returns the issues edited in each round.
+	sample := func(projects []string, rounds int) [][]int64 {
+		db := storage.MemDB()
+		gh := github.New(lg, db, nil, nil)
+		for _, file := range []string{"../testdata/rsctmp.txt", "../testdata/markdown.txt"} {
+			if err := loadSample(gh, file); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dc := docs.New(db)
+		vdb := storage.MemVectorDB(db, lg, "")
+		cf, rp := policies(lg, db, gh, vdb, dc, projects, since, "")
+		var edited [][]int64
+		for round := range rounds {
+			runRound(ctx, round+1, lg, gh, dc, vdb, llm.QuoteEmbedder(), cf, rp)
+			var issues []int64
+			for _, e := range gh.Testing().Edits() {
+				if e.Project != "rsc/markdown" {
+					t.Errorf("edit of other project: %v", e)
+				}
+				issues = append(issues, e.Issue)
+			}
+			edited = append(edited, issues)
+			gh.Testing().ClearEdits()
+		}
+		return edited
+	}
+
+	// The poster comments on the sample issues once.
+	edited := sample([]string{"rsc/markdown"}, 2)
+	if !slices.Equal(edited[0], []int64{13, 19}) || len(edited[1]) != 0 {
+		t.Errorf("sample rounds edited %v, want [[13 19] []]", edited)
+	}
+
+	// Each listed project is processed, not just the first.
+	edited = sample([]string{"rsc/tmp", "rsc/markdown"}, 1)
+	if !slices.Equal(edited[0], []int64{13, 19}) {
+		t.Errorf("sample with two projects edited %v, want [13 19]", edited)
+	}
+
+	// Projects not in the sample files have nothing to do.
+	edited = sample([]string{"golang/go"}, 1)
+	if len(edited[0]) != 0 {
+		t.Errorf("sample with -projects golang/go edited %v, want none", edited)
+	}
+}
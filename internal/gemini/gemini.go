@@ -11,17 +11,25 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"maps"
 	"net/http"
 	"slices"
 	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/generative-ai-go/genai"
 	"golang.org/x/oscar/internal/httprr"
 	"golang.org/x/oscar/internal/llm"
 	"golang.org/x/oscar/internal/secret"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -51,6 +59,16 @@ func Scrub(req *http.Request) error {
 type Client struct {
 	slog  *slog.Logger
 	genai *genai.Client
+	tr    *transportWithKey
+
+	headRunes int // see SetTextLimit
+	tailRunes int
+
+	concurrency int // see SetConcurrency
+
+	mu          sync.Mutex
+	retryBudget int         // see SetRetryBudget
+	retries     []time.Time // times of retries in the last minute
 }
 
 // NewClient returns a connection to Gemini, using the given logger and HTTP client.
@@ -73,61 +91,449 @@ func NewClient(lg *slog.Logger, sdb secret.DB, hc *http.Client) (*Client, error)
 	// otherwise NewClient complains that we haven't passed in a key.
 	// (If we pass in the key, it ignores it, but if we don't pass it in,
 	// it complains that we didn't give it a key.)
+	hc, tr := withKey(hc, key)
 	ai, err := genai.NewClient(context.Background(),
 		option.WithAPIKey("ignored"),
-		option.WithHTTPClient(withKey(hc, key)))
+		option.WithHTTPClient(hc))
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{slog: lg, genai: ai}, nil
+	return &Client{
+		slog:        lg,
+		genai:       ai,
+		tr:          tr,
+		headRunes:   defaultHeadRunes,
+		tailRunes:   defaultTailRunes,
+		retryBudget: defaultRetryBudget,
+		concurrency: 1,
+	}, nil
+}
+
+// SetHeaders sets extra HTTP headers to add to every request to Gemini,
+// such as those required by an authenticating proxy.
+// The headers are added to any the request already has.
+// Headers named X-Goog-Api-Key or Content-Type are ignored:
+// the client always sets those itself.
+// SetHeaders must be called before the client is used.
+func (c *Client) SetHeaders(h http.Header) {
+	hdr := make(http.Header)
+	for k, v := range h {
+		k = http.CanonicalHeaderKey(k)
+		if k == "X-Goog-Api-Key" || k == "Content-Type" {
+			c.slog.Warn("gemini ignoring header", "header", k)
+			continue
+		}
+		hdr[k] = append(hdr[k], v...)
+	}
+	c.tr.header = hdr
+}
+
+// SetRequestLogger arranges for f to be called after each request
+// to Gemini, with the raw bodies of the request and of the response,
+// for debugging. If the request fails without a response,
+// resp is nil. The API key is sent in a header, so it never
+// appears in either body.
+// f may be called from multiple goroutines at once
+// (see [Client.SetConcurrency]).
+// SetRequestLogger must be called before the client is used;
+// passing a nil f turns off logging.
+func (c *Client) SetRequestLogger(f func(req, resp []byte)) {
+	c.tr.log = f
 }
 
 // withKey returns a new http.Client that is the same as hc
 // except that it adds "x-goog-api-key: key" to every request.
-func withKey(hc *http.Client, key string) *http.Client {
+// It also returns the client's transport, for use by [Client.SetHeaders].
+func withKey(hc *http.Client, key string) (*http.Client, *transportWithKey) {
 	c := *hc
 	t := c.Transport
 	if t == nil {
 		t = http.DefaultTransport
 	}
-	c.Transport = &transportWithKey{t, key}
-	return &c
+	tr := &transportWithKey{rt: t, key: key}
+	c.Transport = tr
+	return &c, tr
 }
 
 // transportWithKey is the same as rt
-// except that it adds "x-goog-api-key: key" to every request.
+// except that it adds "x-goog-api-key: key" and any extra headers
+// to every request.
 type transportWithKey struct {
-	rt  http.RoundTripper
-	key string
+	rt     http.RoundTripper
+	key    string
+	header http.Header            // see Client.SetHeaders
+	log    func(req, resp []byte) // see Client.SetRequestLogger
 }
 
 func (t *transportWithKey) RoundTrip(req *http.Request) (resp *http.Response, err error) {
 	r := *req
 	r.Header = maps.Clone(req.Header)
+	for k, v := range t.header {
+		r.Header[k] = slices.Concat(r.Header[k], v)
+	}
 	r.Header["x-goog-api-key"] = []string{t.key}
-	return t.rt.RoundTrip(&r)
+	if t.log == nil {
+		return t.rt.RoundTrip(&r)
+	}
+
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err = t.rt.RoundTrip(&r)
+	if err != nil {
+		t.log(reqBody, nil)
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	t.log(reqBody, respBody)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CheckKey checks that the client's API key is accepted by Gemini,
+// by making a cheap request to list the available models.
+func (c *Client) CheckKey(ctx context.Context) error {
+	if _, err := c.genai.ListModels(ctx).Next(); err != nil && err != iterator.Done {
+		return fmt.Errorf("gemini CheckKey: %w", err)
+	}
+	return nil
 }
 
 const maxBatch = 100 // empirical limit
 
+// SetTextLimit sets the maximum amount of document text sent to Gemini.
+// A document text longer than head+tail runes is cut down to
+// its first head runes and last tail runes, with a short note
+// in between saying how much was elided.
+// Only the text sent to Gemini is shortened; the caller's documents are unchanged.
+//
+// The default is to keep the first 6000 and last 2000 runes,
+// which keeps typical issue text intact while staying under the
+// embedding model's input limit for issues containing very large logs.
+func (c *Client) SetTextLimit(head, tail int) {
+	c.headRunes = head
+	c.tailRunes = tail
+}
+
+const (
+	defaultHeadRunes = 6000
+	defaultTailRunes = 2000
+)
+
+// truncate returns text cut down to its first head runes
+// and last tail runes, with a note in between.
+// If text has no more than head+tail runes, truncate returns it unchanged.
+func truncate(text string, head, tail int) string {
+	n := utf8.RuneCountInString(text)
+	if n <= head+tail {
+		return text
+	}
+	i, start, end := 0, 0, len(text)
+	for j := range text {
+		if i == head {
+			start = j
+		}
+		if i == n-tail {
+			end = j
+			break
+		}
+		i++
+	}
+	return fmt.Sprintf("%s\n\n[… %d characters elided …]\n\n%s", text[:start], n-head-tail, text[end:])
+}
+
+// SetConcurrency sets the maximum number of batch embedding requests
+// that a single call to [Client.EmbedDocs] has in flight at once.
+// All the requests still share the client's retry budget
+// (see [Client.SetRetryBudget]).
+// The default is 1, meaning batches are embedded one at a time.
+func (c *Client) SetConcurrency(n int) {
+	c.concurrency = max(n, 1)
+}
+
 // EmbedDocs returns the vector embeddings for the docs,
 // implementing [llm.Embedder].
 func (c *Client) EmbedDocs(ctx context.Context, docs []llm.EmbedDoc) ([]llm.Vector, error) {
 	model := c.genai.EmbeddingModel("text-embedding-004")
-	var vecs []llm.Vector
-	for docs := range slices.Chunk(docs, maxBatch) {
-		b := model.NewBatch()
-		for _, d := range docs {
-			b.AddContentWithTitle(d.Title, genai.Text(d.Text))
+	batches := slices.Collect(slices.Chunk(docs, maxBatch))
+	vecs := make([][]llm.Vector, len(batches))
+	errs := make([]error, len(batches))
+
+	// Once a batch fails, only the vectors for the batches before it
+	// can be returned, so cancel the batches after it,
+	// leaving the earlier ones running.
+	// Batches canceled that way report the error that caused it.
+	ctxs := make([]context.Context, len(batches))
+	cancels := make([]context.CancelCauseFunc, len(batches))
+	for i := range batches {
+		ctxs[i], cancels[i] = context.WithCancelCause(ctx)
+		defer cancels[i](nil)
+	}
+	var (
+		mu     sync.Mutex
+		failed = len(batches) // index of first failed batch
+	)
+	fail := func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = min(failed, i)
+		for j := i + 1; j < len(batches); j++ {
+			cancels[j](err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	sema := make(chan struct{}, c.concurrency)
+	for i, docs := range batches {
+		sema <- struct{}{}
+		mu.Lock()
+		skip := failed < i
+		mu.Unlock()
+		if skip {
+			// An earlier batch failed; skip the rest.
+			errs[i] = context.Cause(ctxs[i])
+			<-sema
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sema
+				wg.Done()
+			}()
+			b := model.NewBatch()
+			for _, d := range docs {
+				b.AddContentWithTitle(d.Title, genai.Text(truncate(d.Text, c.headRunes, c.tailRunes)))
+			}
+			resp, err := c.batchEmbed(ctxs[i], model, b)
+			if err != nil {
+				if ctxs[i].Err() != nil {
+					err = context.Cause(ctxs[i])
+				}
+				errs[i] = err
+				fail(i, err)
+				return
+			}
+			for _, e := range resp.Embeddings {
+				vecs[i] = append(vecs[i], e.Values)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var all []llm.Vector
+	for i := range batches {
+		if errs[i] != nil {
+			return all, errs[i]
 		}
+		all = append(all, vecs[i]...)
+	}
+	return all, nil
+}
+
+// ErrRetryBudget is returned (wrapped around the underlying error)
+// when a request fails and the client has no retries left in its budget.
+// See [Client.SetRetryBudget].
+var ErrRetryBudget = errors.New("gemini retry budget exhausted")
+
+// SetRetryBudget sets the maximum number of retries the client
+// makes in any one-minute period, counting all requests together.
+// Failed requests are retried only for errors that might succeed
+// when tried again, such as rate limiting and server overload.
+// Sharing the budget across all requests means that a burst of
+// failures backs off the whole client instead of having each request
+// retry on its own and collectively hammer the service.
+//
+// The default budget is 10 retries per minute.
+// A budget of 0 disables retries.
+func (c *Client) SetRetryBudget(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retryBudget = n
+}
+
+const (
+	defaultRetryBudget = 10
+	maxTries           = 5 // maximum tries for a single request
+)
+
+// batchEmbed calls model.BatchEmbedContents(ctx, b),
+// retrying retryable failures as allowed by the retry budget.
+func (c *Client) batchEmbed(ctx context.Context, model *genai.EmbeddingModel, b *genai.EmbeddingBatch) (*genai.BatchEmbedContentsResponse, error) {
+	for try := 1; ; try++ {
 		resp, err := model.BatchEmbedContents(ctx, b)
-		if err != nil {
-			return vecs, err
+		if err == nil {
+			return resp, nil
 		}
-		for _, e := range resp.Embeddings {
-			vecs = append(vecs, e.Values)
+		q := parseQuota(err)
+		if q != nil && q.exhausted() {
+			return nil, q
 		}
+		if !retryable(err) || try >= maxTries {
+			return nil, err
+		}
+		if !c.takeRetry() {
+			return nil, fmt.Errorf("%w: %w", ErrRetryBudget, err)
+		}
+		c.slog.Info("gemini retry", "try", try, "err", err)
+		if !testing.Testing() {
+			// unreachable in tests
+			delay := time.Duration(try) * 2 * time.Second
+			if q != nil && q.RetryDelay > delay {
+				delay = q.RetryDelay
+			}
+			// Stop waiting if ctx is canceled, such as when
+			// another batch in a concurrent EmbedDocs has failed.
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, context.Cause(ctx)
+			}
+		}
+	}
+}
+
+// A QuotaExceededError is returned when a request fails because
+// a Gemini quota is exhausted and will not reset soon,
+// such as a daily request quota.
+// Those failures are not retried, since retrying cannot succeed
+// until the quota resets.
+// (Per-minute rate limits are retried as usual.)
+type QuotaExceededError struct {
+	Quota      string        // the exhausted quota, such as "EmbedContentRequestsPerDayPerProjectPerModel"; may be empty
+	RetryDelay time.Duration // server's suggested wait before trying again; 0 if unknown
+	Err        error         // underlying error
+}
+
+func (e *QuotaExceededError) Error() string {
+	msg := "gemini quota exceeded"
+	if e.Quota != "" {
+		msg += " (" + e.Quota + ")"
+	}
+	if e.RetryDelay > 0 {
+		msg += fmt.Sprintf("; retry after %v", e.RetryDelay)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return e.Err
+}
+
+// maxRetryDelay is the longest server-suggested retry delay
+// that batchEmbed will wait out. A longer suggested delay
+// is treated as an exhausted quota.
+const maxRetryDelay = time.Minute
+
+// exhausted reports whether the quota described by e
+// is one that retrying will not fix soon.
+func (e *QuotaExceededError) exhausted() bool {
+	return strings.Contains(e.Quota, "PerDay") || e.RetryDelay > maxRetryDelay
+}
+
+// parseQuota parses the details of a 429 Too Many Requests error
+// from Gemini, which look like:
+//
+//	{"error": {
+//		"code": 429,
+//		"status": "RESOURCE_EXHAUSTED",
+//		"details": [
+//			{"@type": "type.googleapis.com/google.rpc.QuotaFailure",
+//			 "violations": [{"quotaId": "EmbedContentRequestsPerMinutePerProjectPerModel", ...}]},
+//			{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "43s"}
+//		]
+//	}}
+//
+// If err is not a 429 error, parseQuota returns nil.
+// Otherwise it returns a QuotaExceededError describing the quota,
+// which the caller can check with [QuotaExceededError.exhausted].
+//
+// The details are decoded directly instead of using the gax apierror
+// package, because the protobuf decoding used there discards all
+// details when Gemini includes fields that are newer than
+// the protobuf definitions we build with.
+func parseQuota(err error) *QuotaExceededError {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusTooManyRequests {
+		return nil
+	}
+	var body struct {
+		Error struct {
+			Details []struct {
+				Type       string `json:"@type"`
+				RetryDelay string `json:"retryDelay"`
+				Violations []struct {
+					QuotaID string `json:"quotaId"`
+				} `json:"violations"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	q := &QuotaExceededError{Err: err}
+	if json.Unmarshal([]byte(gerr.Body), &body) != nil {
+		return q
+	}
+	for _, d := range body.Error.Details {
+		switch d.Type {
+		case "type.googleapis.com/google.rpc.QuotaFailure":
+			for _, v := range d.Violations {
+				if q.Quota == "" || strings.Contains(v.QuotaID, "PerDay") {
+					q.Quota = v.QuotaID
+				}
+			}
+		case "type.googleapis.com/google.rpc.RetryInfo":
+			if delay, err := time.ParseDuration(d.RetryDelay); err == nil {
+				q.RetryDelay = delay
+			}
+		}
+	}
+	return q
+}
+
+// takeRetry reports whether the retry budget allows another retry,
+// and if so, records the retry against the budget.
+func (c *Client) takeRetry() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.retries = slices.DeleteFunc(c.retries, func(t time.Time) bool {
+		return now.Sub(t) >= time.Minute
+	})
+	if len(c.retries) >= c.retryBudget {
+		return false
+	}
+	c.retries = append(c.retries, now)
+	return true
+}
+
+// retryable reports whether the request that failed with err
+// might succeed if tried again.
+//
+// The genai client already retries 503 Service Unavailable responses
+// on its own until the request deadline, so retrying those again
+// here would only multiply that work.
+func retryable(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return false
+	}
+	switch gerr.Code {
+	case http.StatusTooManyRequests, // 429
+		http.StatusInternalServerError, // 500
+		http.StatusBadGateway,          // 502
+		http.StatusGatewayTimeout:      // 504
+		return true
 	}
-	return vecs, nil
+	return false
 }
@@ -7,9 +7,16 @@ package gemini
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"golang.org/x/oscar/internal/httprr"
 	"golang.org/x/oscar/internal/llm"
@@ -105,3 +112,403 @@ func TestBigBatch(t *testing.T) {
 		t.Fatalf("len(vecs) = %d, but len(docs) = %d", len(vecs), len(docs))
 	}
 }
+
+var truncateTests = []struct {
+	text       string
+	head, tail int
+	out        string
+}{
+	{"", 2, 2, ""},
+	{"abcd", 2, 2, "abcd"},
+	{"abcde", 2, 2, "ab\n\n[… 1 characters elided …]\n\nde"},
+	{"abcde", 0, 2, "\n\n[… 3 characters elided …]\n\nde"},
+	{"abcde", 2, 0, "ab\n\n[… 3 characters elided …]\n\n"},
+	{"αβγδεζ", 1, 2, "α\n\n[… 3 characters elided …]\n\nεζ"},
+}
+
+func TestTruncate(t *testing.T) {
+	for _, tt := range truncateTests {
+		out := truncate(tt.text, tt.head, tt.tail)
+		if out != tt.out {
+			t.Errorf("truncate(%q, %d, %d) = %q, want %q", tt.text, tt.head, tt.tail, out, tt.out)
+		}
+	}
+}
+
+// A roundTripFunc is an [http.RoundTripper] implemented by a function.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newFailClient returns a client whose requests all fail with the given HTTP status code.
+// It also returns a pointer to the count of requests made.
+func newFailClient(t *testing.T, code int) (*Client, *int) {
+	return newFailBodyClient(t, code, fmt.Sprintf(`{"error":{"code":%d,"message":"failure"}}`, code))
+}
+
+// newFailBodyClient is like newFailClient but uses body as the failure response body.
+func newFailBodyClient(t *testing.T, code int, body string) (*Client, *int) {
+	n := new(int)
+	hc := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		*n++
+		return &http.Response{
+			StatusCode: code,
+			Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})}
+	c, err := NewClient(testutil.Slogger(t), secret.ReadOnlyMap{"ai.google.dev": "nokey"}, hc)
+	testutil.Check(t, err)
+	return c, n
+}
+
+func TestRetryBudget(t *testing.T) {
+	ctx := context.Background()
+	c, n := newFailClient(t, http.StatusInternalServerError)
+	c.SetRetryBudget(6)
+
+	// First request uses up 4 retries (5 tries), then gives up.
+	_, err := c.EmbedDocs(ctx, docs)
+	if err == nil || errors.Is(err, ErrRetryBudget) || *n != maxTries {
+		t.Fatalf("EmbedDocs #1: %d requests, err=%v, want %d requests and non-budget error", *n, err, maxTries)
+	}
+
+	// Second request has only 2 retries left in the budget.
+	*n = 0
+	_, err = c.EmbedDocs(ctx, docs)
+	if !errors.Is(err, ErrRetryBudget) || *n != 3 {
+		t.Fatalf("EmbedDocs #2: %d requests, err=%v, want 3 requests and ErrRetryBudget", *n, err)
+	}
+
+	// Budget is exhausted: no retries at all.
+	*n = 0
+	_, err = c.EmbedDocs(ctx, docs)
+	if !errors.Is(err, ErrRetryBudget) || *n != 1 {
+		t.Fatalf("EmbedDocs #3: %d requests, err=%v, want 1 request and ErrRetryBudget", *n, err)
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	c, n := newFailClient(t, http.StatusBadRequest)
+	_, err := c.EmbedDocs(context.Background(), docs)
+	if err == nil || *n != 1 {
+		t.Fatalf("EmbedDocs: %d requests, err=%v, want 1 request and error", *n, err)
+	}
+}
+
+const quotaBody = `{"error": {
+	"code": 429,
+	"message": "Resource has been exhausted (e.g. check quota).",
+	"status": "RESOURCE_EXHAUSTED",
+	"details": [
+		{"@type": "type.googleapis.com/google.rpc.QuotaFailure",
+		 "violations": [{"quotaMetric": "generativelanguage.googleapis.com/embed_content_requests", "quotaId": "%s"}]},
+		{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "%s"}
+	]
+}}`
+
+var quotaTests = []struct {
+	quota string
+	delay string
+	tries int // requests made by EmbedDocs
+	want  time.Duration
+}{
+	{"EmbedContentRequestsPerMinutePerProjectPerModel", "17s", maxTries, 0},
+	{"EmbedContentRequestsPerDayPerProjectPerModel", "3600s", 1, time.Hour},
+	{"EmbedContentRequestsPerDayPerProjectPerModel", "", 1, 0},
+	{"EmbedContentRequestsPerMinutePerProjectPerModel", "7200s", 1, 2 * time.Hour},
+}
+
+func TestQuota(t *testing.T) {
+	for _, tt := range quotaTests {
+		c, n := newFailBodyClient(t, http.StatusTooManyRequests, fmt.Sprintf(quotaBody, tt.quota, tt.delay))
+		_, err := c.EmbedDocs(context.Background(), docs)
+		if *n != tt.tries {
+			t.Errorf("%s %s: EmbedDocs made %d requests, want %d", tt.quota, tt.delay, *n, tt.tries)
+		}
+		var q *QuotaExceededError
+		if !errors.As(err, &q) {
+			if tt.tries == 1 {
+				t.Errorf("%s %s: EmbedDocs err = %v, want QuotaExceededError", tt.quota, tt.delay, err)
+			}
+			continue
+		}
+		if tt.tries != 1 {
+			t.Errorf("%s %s: EmbedDocs err = %v, want transient error", tt.quota, tt.delay, err)
+			continue
+		}
+		if q.Quota != tt.quota || q.RetryDelay != tt.want {
+			t.Errorf("%s %s: QuotaExceededError{Quota: %q, RetryDelay: %v}, want {%q, %v}", tt.quota, tt.delay, q.Quota, q.RetryDelay, tt.quota, tt.want)
+		}
+	}
+
+	// A 429 with no details is an ordinary rate limit.
+	c, n := newFailClient(t, http.StatusTooManyRequests)
+	_, err := c.EmbedDocs(context.Background(), docs)
+	var q *QuotaExceededError
+	if errors.As(err, &q) || *n != maxTries {
+		t.Errorf("EmbedDocs with plain 429: %d requests, err=%v, want %d requests and non-quota error", *n, err, maxTries)
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	ctx := context.Background()
+	hc := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"models":[{"name":"models/text-embedding-004"}]}`)),
+			Request:    req,
+		}, nil
+	})}
+	c, err := NewClient(testutil.Slogger(t), secret.ReadOnlyMap{"ai.google.dev": "nokey"}, hc)
+	testutil.Check(t, err)
+	if err := c.CheckKey(ctx); err != nil {
+		t.Errorf("CheckKey with good key: %v", err)
+	}
+
+	c, _ = newFailClient(t, http.StatusBadRequest)
+	if err := c.CheckKey(ctx); err == nil {
+		t.Errorf("CheckKey with bad key succeeded")
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	var hdr http.Header
+	hc := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		hdr = req.Header
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"models":[]}`)),
+			Request:    req,
+		}, nil
+	})}
+	c, err := NewClient(testutil.Slogger(t), secret.ReadOnlyMap{"ai.google.dev": "realkey"}, hc)
+	testutil.Check(t, err)
+	c.SetHeaders(http.Header{
+		"X-Goog-User-Project": {"my-project"},
+		"proxy-authorization": {"Bearer token"},
+		"X-Goog-Api-Key":      {"otherkey"},
+		"Content-Type":        {"text/plain"},
+	})
+	testutil.Check(t, c.CheckKey(context.Background()))
+
+	if got := hdr.Get("X-Goog-User-Project"); got != "my-project" {
+		t.Errorf("X-Goog-User-Project = %q, want %q", got, "my-project")
+	}
+	if got := hdr.Get("Proxy-Authorization"); got != "Bearer token" {
+		t.Errorf("Proxy-Authorization = %q, want %q", got, "Bearer token")
+	}
+	if got := hdr["x-goog-api-key"]; !slices.Equal(got, []string{"realkey"}) {
+		t.Errorf("x-goog-api-key = %q, want [realkey]", got)
+	}
+	if got := hdr.Get("X-Goog-Api-Key"); got != "" {
+		t.Errorf("X-Goog-Api-Key = %q, want none", got)
+	}
+	if got := hdr.Get("Content-Type"); got == "text/plain" {
+		t.Errorf("Content-Type overridden by SetHeaders")
+	}
+}
+
+// newEmbedClient returns a client whose batch embedding requests succeed,
+// returning for each document a one-dimensional vector holding
+// the length of its text. If fail is non-empty, a batch containing
+// a document with that text fails with a 400 Bad Request.
+func newEmbedClient(t *testing.T, fail string) *Client {
+	return newWrappedEmbedClient(t, fail, nil)
+}
+
+// newWrappedEmbedClient is like newEmbedClient,
+// but if wrap is not nil, requests go through wrap(rt) instead of rt,
+// where rt is the fake embedding server.
+func newWrappedEmbedClient(t *testing.T, fail string, wrap func(rt roundTripFunc) roundTripFunc) *Client {
+	var rt roundTripFunc = func(req *http.Request) (*http.Response, error) {
+		var body struct {
+			Requests []struct {
+				Content struct {
+					Parts []struct {
+						Text string `json:"text"`
+					} `json:"parts"`
+				} `json:"content"`
+			} `json:"requests"`
+		}
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			return nil, err
+		}
+		code, out := http.StatusOK, new(bytes.Buffer)
+		out.WriteString(`{"embeddings":[`)
+		for i, r := range body.Requests {
+			text := r.Content.Parts[0].Text
+			if fail != "" && text == fail {
+				code = http.StatusBadRequest
+			}
+			if i > 0 {
+				out.WriteString(",")
+			}
+			fmt.Fprintf(out, `{"values":[%d]}`, len(text))
+		}
+		out.WriteString(`]}`)
+		if code != http.StatusOK {
+			out.Reset()
+			out.WriteString(`{"error":{"code":400,"message":"failure"}}`)
+		}
+		return &http.Response{
+			StatusCode: code,
+			Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(out),
+			Request:    req,
+		}, nil
+	}
+	if wrap != nil {
+		rt = wrap(rt)
+	}
+	hc := &http.Client{Transport: rt}
+	c, err := NewClient(testutil.Slogger(t), secret.ReadOnlyMap{"ai.google.dev": "nokey"}, hc)
+	testutil.Check(t, err)
+	return c
+}
+
+func TestConcurrency(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	var docs []llm.EmbedDoc
+	for i := range 1234 {
+		docs = append(docs, llm.EmbedDoc{Text: strings.Repeat("x", i)})
+	}
+
+	c := newEmbedClient(t, "")
+	want, err := c.EmbedDocs(ctx, docs)
+	check(err)
+	c.SetConcurrency(4)
+	vecs, err := c.EmbedDocs(ctx, docs)
+	check(err)
+	if len(vecs) != len(docs) {
+		t.Fatalf("len(vecs) = %d, but len(docs) = %d", len(vecs), len(docs))
+	}
+	for i := range vecs {
+		if !slices.Equal(vecs[i], want[i]) {
+			t.Fatalf("concurrent vecs[%d] = %v, sequential %v", i, vecs[i], want[i])
+		}
+	}
+
+	// A failure returns the vectors for the batches before the failing one.
+	c = newEmbedClient(t, docs[2*maxBatch+5].Text)
+	c.SetConcurrency(4)
+	vecs, err = c.EmbedDocs(ctx, docs)
+	if err == nil || len(vecs) != 2*maxBatch {
+		t.Fatalf("EmbedDocs with failing batch: len(vecs) = %d, err = %v, want %d vecs and error", len(vecs), err, 2*maxBatch)
+	}
+	for i := range vecs {
+		if !slices.Equal(vecs[i], want[i]) {
+			t.Fatalf("vecs[%d] = %v, want %v", i, vecs[i], want[i])
+		}
+	}
+}
+
+func TestConcurrencyParallel(t *testing.T) {
+	var docs []llm.EmbedDoc
+	for i := range 4 * maxBatch {
+		docs = append(docs, llm.EmbedDoc{Text: strings.Repeat("x", i)})
+	}
+
+	// Each request waits until all four batches are in flight.
+	var (
+		mu      sync.Mutex
+		arrived int
+		all     = make(chan struct{})
+	)
+	c := newWrappedEmbedClient(t, "", func(rt roundTripFunc) roundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			if arrived++; arrived == 4 {
+				close(all)
+			}
+			mu.Unlock()
+			select {
+			case <-all:
+			case <-time.After(5 * time.Second):
+				return nil, fmt.Errorf("batches did not run in parallel")
+			}
+			return rt(req)
+		}
+	})
+	c.SetConcurrency(4)
+	vecs, err := c.EmbedDocs(context.Background(), docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vecs) != len(docs) {
+		t.Fatalf("len(vecs) = %d, but len(docs) = %d", len(vecs), len(docs))
+	}
+}
+
+func TestConcurrencyLaterFailure(t *testing.T) {
+	var docs []llm.EmbedDoc
+	for i := range 2 * maxBatch {
+		docs = append(docs, llm.EmbedDoc{Text: strings.Repeat("x", i+1)})
+	}
+
+	// The first batch answers only after the second batch has failed,
+	// and fails if it is canceled before then.
+	failed := make(chan struct{})
+	c := newWrappedEmbedClient(t, docs[maxBatch+5].Text, func(rt roundTripFunc) roundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			data, err := io.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			req.Body = io.NopCloser(bytes.NewReader(data))
+			if !strings.Contains(string(data), `"text":"x"`) {
+				resp, err := rt(req)
+				close(failed)
+				return resp, err
+			}
+			select {
+			case <-failed:
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+			return rt(req)
+		}
+	})
+	c.SetConcurrency(2)
+	vecs, err := c.EmbedDocs(context.Background(), docs)
+	if err == nil || len(vecs) != maxBatch {
+		t.Fatalf("EmbedDocs with failing second batch: len(vecs) = %d, err = %v, want %d vecs and error", len(vecs), err, maxBatch)
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	c := newEmbedClient(t, "")
+	var reqs, resps []string
+	c.SetRequestLogger(func(req, resp []byte) {
+		reqs = append(reqs, string(req))
+		resps = append(resps, string(resp))
+	})
+	vecs, err := c.EmbedDocs(context.Background(), docs)
+	testutil.Check(t, err)
+	if len(vecs) != len(docs) {
+		t.Fatalf("len(vecs) = %d, but len(docs) = %d", len(vecs), len(docs))
+	}
+	if len(reqs) != 1 {
+		t.Fatalf("logged %d requests, want 1", len(reqs))
+	}
+	if !strings.Contains(reqs[0], docs[0].Text) || strings.Contains(reqs[0], "nokey") {
+		t.Errorf("logged request body = %s, want body with document text and without API key", reqs[0])
+	}
+	if !strings.Contains(resps[0], `"embeddings"`) {
+		t.Errorf("logged response body = %s, want embeddings", resps[0])
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"iter"
 	"math"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -21,25 +22,12 @@ import (
 // (for example "https://github.com/golang/go/issues/12345"),
 // only consulting the database (not actual GitHub).
 func (c *Client) LookupIssueURL(url string) (*Issue, error) {
-	bad := func() (*Issue, error) {
+	if !strings.HasPrefix(url, "https://github.com/") {
 		return nil, fmt.Errorf("not a github URL: %q", url)
 	}
-	proj, ok := strings.CutPrefix(url, "https://github.com/")
-	if !ok {
-		return bad()
-	}
-	// If this used strings.Index instead of strings.LastIndex,
-	// we could use strings.Cut instead. But it doesn't, so we can't.
-	// Have to handle a hypothetical repo named golang/issues,
-	// which would have URLs like https://github.com/golang/issues/issues/12345.
-	i := strings.LastIndex(proj, "/issues/")
-	if i < 0 {
-		return bad()
-	}
-	proj, num := proj[:i], proj[i+len("/issues/"):]
-	n, err := strconv.ParseInt(num, 10, 64)
-	if err != nil || n <= 0 {
-		return bad()
+	proj, n, err := ParseIssueRef(url)
+	if err != nil {
+		return nil, fmt.Errorf("not a github URL: %q", url)
 	}
 
 	for e := range c.Events(proj, n, n) {
@@ -50,6 +38,54 @@ func (c *Client) LookupIssueURL(url string) (*Issue, error) {
 	return nil, fmt.Errorf("%s#%d not in database", proj, n)
 }
 
+// ParseIssueRef parses a reference to a GitHub issue, returning
+// the project (for example "golang/go") and the issue number.
+// It accepts these forms:
+//
+//	123
+//	#123
+//	golang/go#123
+//	https://github.com/golang/go/issues/123
+//
+// For the first two forms, which do not name a project,
+// ParseIssueRef returns an empty project.
+func ParseIssueRef(s string) (project string, number int64, err error) {
+	bad := func() (string, int64, error) {
+		return "", 0, fmt.Errorf("invalid issue reference %q (want 123, #123, owner/repo#123, or https://github.com/owner/repo/issues/123)", s)
+	}
+	var num string
+	if rest, ok := strings.CutPrefix(s, "https://github.com/"); ok {
+		// If this used strings.Index instead of strings.LastIndex,
+		// we could use strings.Cut instead. But it doesn't, so we can't.
+		// Have to handle a hypothetical repo named golang/issues,
+		// which would have URLs like https://github.com/golang/issues/issues/12345.
+		i := strings.LastIndex(rest, "/issues/")
+		if i < 0 {
+			return bad()
+		}
+		project, num = rest[:i], rest[i+len("/issues/"):]
+	} else if i := strings.LastIndex(s, "#"); i >= 0 {
+		project, num = s[:i], s[i+1:]
+	} else {
+		num = s
+	}
+	if project != "" {
+		owner, repo, ok := strings.Cut(project, "/")
+		if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return bad()
+		}
+	}
+	// Reject signs and other oddities that ParseInt would allow.
+	if num == "" || strings.Trim(num, "0123456789") != "" {
+		return bad()
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return bad()
+	}
+	return project, n, nil
+}
+
 // An Event is a single GitHub issue event stored in the database.
 type Event struct {
 	DBTime  timed.DBTime // when event was last written
@@ -83,6 +119,32 @@ func (c *Client) Events(project string, issueMin, issueMax int64) iter.Seq[*Even
 	}
 }
 
+// Comments returns an iterator over the comments on issue
+// that are stored in the database, in the order they were posted.
+// Like [Client.LookupIssueURL], it only consults the database,
+// so the comments are the ones seen as of the last sync.
+func (c *Client) Comments(issue *Issue) iter.Seq[*IssueComment] {
+	return func(yield func(*IssueComment) bool) {
+		for e := range c.Events(issue.Project(), issue.Number, issue.Number) {
+			if e.API == "/issues/comments" && !yield(e.Typed.(*IssueComment)) {
+				return
+			}
+		}
+	}
+}
+
+// CommentsBy is like [Client.Comments] but only returns
+// the comments posted by the GitHub user with the given login.
+func (c *Client) CommentsBy(issue *Issue, login string) iter.Seq[*IssueComment] {
+	return func(yield func(*IssueComment) bool) {
+		for com := range c.Comments(issue) {
+			if com.User.Login == login && !yield(com) {
+				return
+			}
+		}
+	}
+}
+
 // EventsAfter returns an iterator over events in the given project after DBTime t,
 // which should be e.DBTime from the most recent processed event.
 // The events are iterated over in DBTime order, so the DBTime of the last
@@ -178,6 +240,12 @@ type Milestone struct {
 	Title string `json:"title"`
 }
 
+// An IssueType represents an issue's type (for example, "Bug") in GitHub JSON.
+// Issue types are defined by the organization that owns the project.
+type IssueType struct {
+	Name string `json:"name"`
+}
+
 // A Rename describes an issue title renaming in GitHub JSON.
 type Rename struct {
 	From string `json:"from"`
@@ -250,7 +318,9 @@ type Issue struct {
 	Body             string    `json:"body"`
 	Assignees        []User    `json:"assignees"`
 	Milestone        Milestone `json:"milestone"`
+	Type             IssueType `json:"type"`
 	State            string    `json:"state"`
+	StateReason      string    `json:"state_reason"`
 	PullRequest      *struct{} `json:"pull_request"`
 	Locked           bool      `json:"locked"`
 	ActiveLockReason string    `json:"active_lock_reason"`
@@ -261,3 +331,96 @@ type Issue struct {
 func (x *Issue) Project() string {
 	return urlToProject(x.URL)
 }
+
+// String returns a compact multi-line summary of the issue,
+// in a format similar to the headers printed by the [rsc.io/github/issue] command:
+//
+//	golang/go#12345: title of issue
+//	Author: gopher
+//	State: open
+//	Labels: NeedsInvestigation, help wanted
+//	Assignees: rsc
+//
+// Lines for empty labels and assignees lists are omitted.
+// The output depends only on the issue fields, so it can be
+// used in test golden files.
+func (x *Issue) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s#%d: %s\n", x.Project(), x.Number, x.Title)
+	fmt.Fprintf(&b, "Author: %s\n", x.User.Login)
+	fmt.Fprintf(&b, "State: %s\n", x.State)
+	if len(x.Labels) > 0 {
+		fmt.Fprintf(&b, "Labels: %s\n", strings.Join(x.labelNames(), ", "))
+	}
+	if len(x.Assignees) > 0 {
+		var logins []string
+		for _, u := range x.Assignees {
+			logins = append(logins, u.Login)
+		}
+		fmt.Fprintf(&b, "Assignees: %s\n", strings.Join(logins, ", "))
+	}
+	return b.String()
+}
+
+// labelNames returns the names of the issue's labels.
+func (x *Issue) labelNames() []string {
+	var names []string
+	for _, l := range x.Labels {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+// HasAnyLabel reports whether the issue has at least one of the named labels.
+// If names is empty, HasAnyLabel returns false.
+func (x *Issue) HasAnyLabel(names ...string) bool {
+	for _, l := range x.Labels {
+		if slices.Contains(names, l.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAllLabels reports whether the issue has every one of the named labels.
+// If names is empty, HasAllLabels returns true.
+func (x *Issue) HasAllLabels(names ...string) bool {
+	have := x.labelNames()
+	for _, name := range names {
+		if !slices.Contains(have, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasMilestone reports whether the issue has a milestone.
+func (x *Issue) HasMilestone() bool {
+	return x.Milestone.Title != ""
+}
+
+// InMilestone reports whether the issue is in the milestone
+// with the given title (for example, "Go1.24").
+func (x *Issue) InMilestone(title string) bool {
+	return x.HasMilestone() && x.Milestone.Title == title
+}
+
+// DiffLabels compares the issue's labels against before,
+// an earlier snapshot of the label names,
+// returning the labels that have been added and removed since then.
+// Added labels are listed in the order they appear in x.Labels,
+// and removed labels are listed in the order they appear in before.
+func (x *Issue) DiffLabels(before []string) (added, removed []string) {
+	now := x.labelNames()
+	for _, name := range now {
+		if !slices.Contains(before, name) {
+			added = append(added, name)
+		}
+	}
+	for _, name := range before {
+		if !slices.Contains(now, name) {
+			removed = append(removed, name)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package github
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"golang.org/x/oscar/internal/storage"
+	"golang.org/x/oscar/internal/testutil"
+)
+
+func TestIssueString(t *testing.T) {
+	issue := &Issue{
+		URL:       "https://api.github.com/repos/rsc/tmp/issues/1",
+		Number:    1,
+		Title:     "Dummy issue with dummy title",
+		User:      User{Login: "rsc"},
+		State:     "closed",
+		Labels:    []Label{{Name: "NeedsFix"}, {Name: "help wanted"}},
+		Assignees: []User{{Login: "gopher"}, {Login: "rsc"}},
+	}
+	want := `rsc/tmp#1: Dummy issue with dummy title
+Author: rsc
+State: closed
+Labels: NeedsFix, help wanted
+Assignees: gopher, rsc
+`
+	if s := issue.String(); s != want {
+		t.Errorf("String() =\n%s\nwant:\n%s", s, want)
+	}
+
+	issue = &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/2",
+		Number: 2,
+		Title:  "no labels",
+		User:   User{Login: "gopher"},
+		State:  "open",
+	}
+	want = `rsc/tmp#2: no labels
+Author: gopher
+State: open
+`
+	if s := issue.String(); s != want {
+		t.Errorf("String() =\n%s\nwant:\n%s", s, want)
+	}
+}
+
+var diffLabelsTests = []struct {
+	before  []string
+	now     []string
+	added   []string
+	removed []string
+}{
+	{nil, nil, nil, nil},
+	{[]string{"a", "b"}, []string{"a", "b"}, nil, nil},
+	{[]string{"a", "b"}, []string{"b", "a"}, nil, nil},
+	{nil, []string{"a", "b"}, []string{"a", "b"}, nil},
+	{[]string{"a", "b"}, nil, nil, []string{"a", "b"}},
+	{[]string{"a", "b", "c"}, []string{"d", "b", "e"}, []string{"d", "e"}, []string{"a", "c"}},
+}
+
+func TestDiffLabels(t *testing.T) {
+	for _, tt := range diffLabelsTests {
+		issue := new(Issue)
+		for _, name := range tt.now {
+			issue.Labels = append(issue.Labels, Label{Name: name})
+		}
+		added, removed := issue.DiffLabels(tt.before)
+		if !slices.Equal(added, tt.added) || !slices.Equal(removed, tt.removed) {
+			t.Errorf("DiffLabels(%q) with labels %q = %q, %q, want %q, %q", tt.before, tt.now, added, removed, tt.added, tt.removed)
+		}
+	}
+}
+
+func TestHasLabels(t *testing.T) {
+	issue := &Issue{Labels: []Label{{Name: "NeedsFix"}, {Name: "release-blocker"}}}
+	for _, tt := range []struct {
+		names []string
+		any   bool
+		all   bool
+	}{
+		{nil, false, true},
+		{[]string{"NeedsFix"}, true, true},
+		{[]string{"NeedsFix", "release-blocker"}, true, true},
+		{[]string{"NeedsFix", "Documentation"}, true, false},
+		{[]string{"Documentation"}, false, false},
+	} {
+		if any := issue.HasAnyLabel(tt.names...); any != tt.any {
+			t.Errorf("HasAnyLabel(%q) = %v, want %v", tt.names, any, tt.any)
+		}
+		if all := issue.HasAllLabels(tt.names...); all != tt.all {
+			t.Errorf("HasAllLabels(%q) = %v, want %v", tt.names, all, tt.all)
+		}
+	}
+
+	issue = new(Issue)
+	if issue.HasAnyLabel("NeedsFix") || issue.HasAllLabels("NeedsFix") || !issue.HasAllLabels() {
+		t.Errorf("unlabeled issue: HasAnyLabel(NeedsFix)=%v HasAllLabels(NeedsFix)=%v HasAllLabels()=%v, want false, false, true",
+			issue.HasAnyLabel("NeedsFix"), issue.HasAllLabels("NeedsFix"), issue.HasAllLabels())
+	}
+}
+
+var parseIssueRefTests = []struct {
+	in      string
+	project string
+	number  int64
+}{
+	{"123", "", 123},
+	{"#123", "", 123},
+	{"golang/go#123", "golang/go", 123},
+	{"https://github.com/golang/go/issues/123", "golang/go", 123},
+	{"https://github.com/golang/issues/issues/123", "golang/issues", 123},
+
+	// errors
+	{"", "", 0},
+	{"#", "", 0},
+	{"0", "", 0},
+	{"-1", "", 0},
+	{"+1", "", 0},
+	{"12x", "", 0},
+	{"go#123", "", 0},
+	{"/go#123", "", 0},
+	{"golang/#123", "", 0},
+	{"golang/go/x#123", "", 0},
+	{"golang/go#", "", 0},
+	{"https://github.com/golang/go/pull/123", "", 0},
+	{"https://github.com/golang/go/issues/", "", 0},
+	{"https://example.com/golang/go/issues/123", "", 0},
+}
+
+func TestParseIssueRef(t *testing.T) {
+	for _, tt := range parseIssueRefTests {
+		project, number, err := ParseIssueRef(tt.in)
+		if tt.number == 0 {
+			if err == nil {
+				t.Errorf("ParseIssueRef(%q) = %q, %d, nil, want error", tt.in, project, number)
+			}
+			continue
+		}
+		if err != nil || project != tt.project || number != tt.number {
+			t.Errorf("ParseIssueRef(%q) = %q, %d, %v, want %q, %d, nil", tt.in, project, number, err, tt.project, tt.number)
+		}
+	}
+}
+
+func TestMilestone(t *testing.T) {
+	issue := &Issue{Milestone: Milestone{Title: "Go1.24"}}
+	if !issue.HasMilestone() || !issue.InMilestone("Go1.24") || issue.InMilestone("Go1.25") || issue.InMilestone("") {
+		t.Errorf("issue in Go1.24: HasMilestone=%v InMilestone(Go1.24)=%v InMilestone(Go1.25)=%v InMilestone(\"\")=%v, want true, true, false, false",
+			issue.HasMilestone(), issue.InMilestone("Go1.24"), issue.InMilestone("Go1.25"), issue.InMilestone(""))
+	}
+
+	issue = new(Issue)
+	if issue.HasMilestone() || issue.InMilestone("Go1.24") || issue.InMilestone("") {
+		t.Errorf("issue without milestone: HasMilestone=%v InMilestone(Go1.24)=%v InMilestone(\"\")=%v, want false, false, false",
+			issue.HasMilestone(), issue.InMilestone("Go1.24"), issue.InMilestone(""))
+	}
+}
+
+func TestComments(t *testing.T) {
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	tc := c.Testing()
+	issue := &Issue{Number: 1}
+	tc.AddIssue("rsc/tmp", issue)
+
+	// Add comments directly with fixed IDs, instead of using
+	// tc.AddIssueComment, which would change the comment IDs
+	// assigned in other tests.
+	comment := func(issue, id int64, login, body string) {
+		url := fmt.Sprintf("https://api.github.com/repos/rsc/tmp/issues/comments/%d", id)
+		tc.addEvent(url, &Event{
+			Project: "rsc/tmp",
+			Issue:   issue,
+			API:     "/issues/comments",
+			ID:      id,
+			Typed:   &IssueComment{URL: url, User: User{Login: login}, Body: body},
+		})
+	}
+	comment(1, 1, "rsc", "first")
+	comment(1, 2, "gabyhelp", "second")
+	comment(2, 3, "rsc", "other issue")
+	comment(1, 4, "rsc", "third")
+
+	var bodies []string
+	for com := range c.Comments(issue) {
+		bodies = append(bodies, com.Body)
+	}
+	if want := []string{"first", "second", "third"}; !slices.Equal(bodies, want) {
+		t.Errorf("Comments = %q, want %q", bodies, want)
+	}
+
+	bodies = nil
+	for com := range c.CommentsBy(issue, "rsc") {
+		bodies = append(bodies, com.Body)
+	}
+	if want := []string{"first", "third"}; !slices.Equal(bodies, want) {
+		t.Errorf("CommentsBy(rsc) = %q, want %q", bodies, want)
+	}
+
+	for com := range c.CommentsBy(issue, "nobody") {
+		t.Errorf("CommentsBy(nobody) returned %q", com.Body)
+	}
+}
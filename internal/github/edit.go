@@ -6,10 +6,13 @@ package github
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"slices"
 	"strings"
 	"testing"
@@ -23,7 +26,7 @@ import (
 // as high in the stack as possible, and the GitHub client is not.
 
 // PostIssueComment posts a new comment with the given body (written in Markdown) on issue.
-func (c *Client) PostIssueComment(issue *Issue, changes *IssueCommentChanges) error {
+func (c *Client) PostIssueComment(ctx context.Context, issue *Issue, changes *IssueCommentChanges) error {
 	if c.divertEdits() {
 		c.testMu.Lock()
 		defer c.testMu.Unlock()
@@ -36,15 +39,15 @@ func (c *Client) PostIssueComment(issue *Issue, changes *IssueCommentChanges) er
 		return nil
 	}
 
-	return c.post(issue.URL+"/comments", changes)
+	return c.post(ctx, issue.URL+"/comments", changes)
 }
 
 // DownloadIssue downloads the current issue JSON from the given URL
 // and decodes it into an issue.
-// Given an issue, c.DownloadIssue(issue.URL) fetches the very latest state for the issue.
-func (c *Client) DownloadIssue(url string) (*Issue, error) {
+// Given an issue, c.DownloadIssue(ctx, issue.URL) fetches the very latest state for the issue.
+func (c *Client) DownloadIssue(ctx context.Context, url string) (*Issue, error) {
 	x := new(Issue)
-	_, err := c.get(url, "", x)
+	_, err := c.get(ctx, url, "", x)
 	if err != nil {
 		return nil, err
 	}
@@ -53,16 +56,68 @@ func (c *Client) DownloadIssue(url string) (*Issue, error) {
 
 // DownloadIssueComment downloads the current comment JSON from the given URL
 // and decodes it into an IssueComment.
-// Given a comment, c.DownloadIssueComment(comment.URL) fetches the very latest state for the comment.
-func (c *Client) DownloadIssueComment(url string) (*IssueComment, error) {
+// Given a comment, c.DownloadIssueComment(ctx, comment.URL) fetches the very latest state for the comment.
+func (c *Client) DownloadIssueComment(ctx context.Context, url string) (*IssueComment, error) {
 	x := new(IssueComment)
-	_, err := c.get(url, "", x)
+	_, err := c.get(ctx, url, "", x)
 	if err != nil {
 		return nil, err
 	}
 	return x, nil
 }
 
+// Login returns the login name of the GitHub account
+// whose credentials the client is using.
+// Calling Login is a cheap way to check that the credentials are valid.
+func (c *Client) Login(ctx context.Context) (string, error) {
+	var user User
+	if _, err := c.get(ctx, "https://api.github.com/user", "", &user); err != nil {
+		return "", fmt.Errorf("github Login: %w", err)
+	}
+	return user.Login, nil
+}
+
+// maxSearchResults is the maximum number of results
+// GitHub's search API returns for any one query.
+const maxSearchResults = 1000
+
+// SearchIssues returns the issues and pull requests matching the
+// GitHub search query (for example "repo:golang/go is:open label:NeedsFix"),
+// following pagination to collect all results.
+// Like [Client.DownloadIssue], SearchIssues consults GitHub itself,
+// not the database.
+//
+// GitHub rate limits search requests separately from other API requests.
+// SearchIssues waits out rate limits the same way the sync code does.
+// GitHub also caps every search at 1000 results. If the query matches
+// more issues than that, SearchIssues logs a warning and returns the first 1000;
+// use a narrower query to see the rest.
+func (c *Client) SearchIssues(ctx context.Context, query string) ([]*Issue, error) {
+	values := url.Values{
+		"q":        {query},
+		"page":     {"1"},
+		"per_page": {"100"},
+	}
+	urlStr := "https://api.github.com/search/issues?" + values.Encode()
+	var issues []*Issue
+	for first := true; urlStr != ""; first = false {
+		var result struct {
+			TotalCount int64    `json:"total_count"`
+			Items      []*Issue `json:"items"`
+		}
+		resp, err := c.get(ctx, urlStr, "", &result)
+		if err != nil {
+			return nil, fmt.Errorf("SearchIssues(%q): %w", query, err)
+		}
+		if first && result.TotalCount > maxSearchResults {
+			c.slog.Warn("github search truncated", "query", query, "total", result.TotalCount, "max", maxSearchResults)
+		}
+		issues = append(issues, result.Items...)
+		urlStr = findNext(resp.Header.Get("Link"))
+	}
+	return issues, nil
+}
+
 type IssueCommentChanges struct {
 	Body string `json:"body,omitempty"`
 }
@@ -77,7 +132,7 @@ func (ch *IssueCommentChanges) clone() *IssueCommentChanges {
 // It is typically a good idea to use c.DownloadIssueComment first and check
 // that the live comment body matches the one obtained from the database,
 // to minimize race windows.
-func (c *Client) EditIssueComment(comment *IssueComment, changes *IssueCommentChanges) error {
+func (c *Client) EditIssueComment(ctx context.Context, comment *IssueComment, changes *IssueCommentChanges) error {
 	if c.divertEdits() {
 		c.testMu.Lock()
 		defer c.testMu.Unlock()
@@ -91,7 +146,7 @@ func (c *Client) EditIssueComment(comment *IssueComment, changes *IssueCommentCh
 		return nil
 	}
 
-	return c.patch(comment.URL, changes)
+	return c.patch(ctx, comment.URL, changes)
 }
 
 // An IssueChanges specifies changes to make to an issue.
@@ -103,10 +158,12 @@ func (c *Client) EditIssueComment(comment *IssueComment, changes *IssueCommentCh
 // Labels is a *[]string so that it can be set to new([]string)
 // to clear the labels.
 type IssueChanges struct {
-	Title  string    `json:"title,omitempty"`
-	Body   string    `json:"body,omitempty"`
-	State  string    `json:"state,omitempty"`
-	Labels *[]string `json:"labels,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Body        string    `json:"body,omitempty"`
+	State       string    `json:"state,omitempty"`
+	StateReason string    `json:"state_reason,omitempty"` // "completed", "not_planned", or "reopened"
+	Labels      *[]string `json:"labels,omitempty"`
+	Type        string    `json:"type,omitempty"`
 }
 
 func (ch *IssueChanges) clone() *IssueChanges {
@@ -120,7 +177,18 @@ func (ch *IssueChanges) clone() *IssueChanges {
 }
 
 // EditIssue applies the changes to issue on GitHub.
-func (c *Client) EditIssue(issue *Issue, changes *IssueChanges) error {
+// After a successful edit, EditIssue updates issue to match GitHub,
+// so that later edits of the same issue, such as a sequence of
+// [Client.AddLabel] and [Client.RemoveLabel] calls, start from the new state.
+//
+// If [Client.EnableStaleCheck] has been called, EditIssue first
+// checks that the issue has not changed on GitHub since issue was fetched.
+func (c *Client) EditIssue(ctx context.Context, issue *Issue, changes *IssueChanges) error {
+	if c.staleCheck {
+		if err := c.checkStale(ctx, issue); err != nil {
+			return err
+		}
+	}
 	if c.divertEdits() {
 		c.testMu.Lock()
 		defer c.testMu.Unlock()
@@ -130,26 +198,496 @@ func (c *Client) EditIssue(issue *Issue, changes *IssueChanges) error {
 			Issue:        issue.Number,
 			IssueChanges: changes.clone(),
 		})
+		issue.apply(changes)
+		return nil
+	}
+
+	var edited Issue
+	if err := c.json(ctx, "PATCH", issue.URL, changes, &edited); err != nil {
+		return err
+	}
+	issue.Title = edited.Title
+	issue.Body = edited.Body
+	issue.State = edited.State
+	issue.StateReason = edited.StateReason
+	issue.Labels = edited.Labels
+	issue.Type = edited.Type
+	issue.UpdatedAt = edited.UpdatedAt
+	return nil
+}
+
+// apply applies changes to the local copy of issue,
+// for use when edits are diverted during testing.
+// It does not change issue.UpdatedAt, since there is
+// no GitHub response to take the new time from.
+func (issue *Issue) apply(changes *IssueChanges) {
+	if changes.Title != "" {
+		issue.Title = changes.Title
+	}
+	if changes.Body != "" {
+		issue.Body = changes.Body
+	}
+	if changes.State != "" {
+		issue.State = changes.State
+	}
+	if changes.StateReason != "" {
+		issue.StateReason = changes.StateReason
+	}
+	if changes.Type != "" {
+		issue.Type = IssueType{Name: changes.Type}
+	}
+	if changes.Labels != nil {
+		issue.Labels = nil
+		for _, name := range *changes.Labels {
+			issue.Labels = append(issue.Labels, Label{Name: name})
+		}
+	}
+}
+
+// ErrStaleIssue is returned (wrapped) by [Client.EditIssue]
+// when the issue has changed on GitHub since it was fetched.
+// See [Client.EnableStaleCheck].
+var ErrStaleIssue = errors.New("issue changed on GitHub")
+
+// EnableStaleCheck makes [Client.EditIssue], and so also the
+// label helpers like [Client.AddLabel], check that an issue is
+// unchanged on GitHub before editing it. Without the check, an edit
+// made from the database copy of an issue can undo a change that
+// someone made on GitHub since the last sync. The label helpers
+// are especially prone to this, since GitHub only accepts a
+// complete replacement label set.
+//
+// The check downloads the issue and compares its updated_at time
+// with issue.UpdatedAt. If they differ, the edit is skipped
+// and EditIssue returns an error wrapping [ErrStaleIssue];
+// the caller can try again after the next sync.
+// A successful edit updates issue.UpdatedAt from GitHub's response,
+// so a sequence of edits to the same issue passes the check.
+// The check costs one extra GitHub request per edit.
+func (c *Client) EnableStaleCheck() {
+	c.staleCheck = true
+}
+
+// checkStale returns an error if issue has changed on GitHub
+// since it was fetched.
+func (c *Client) checkStale(ctx context.Context, issue *Issue) error {
+	live, err := c.DownloadIssue(ctx, issue.URL)
+	if err != nil {
+		return err
+	}
+	if live.UpdatedAt != issue.UpdatedAt {
+		c.slog.Warn("github skipping edit of changed issue", "project", issue.Project(), "issue", issue.Number, "updated", issue.UpdatedAt, "live", live.UpdatedAt)
+		return fmt.Errorf("%w: %s#%d updated at %s, fetched at %s", ErrStaleIssue, issue.Project(), issue.Number, live.UpdatedAt, issue.UpdatedAt)
+	}
+	return nil
+}
+
+// AddLabel adds the named label to issue on GitHub,
+// keeping the issue's other labels.
+// If the issue already has the label, AddLabel does nothing.
+//
+// The check uses issue.Labels, which is typically the state
+// recorded in the database as of the last sync,
+// updated by any edits made since then using issue.
+func (c *Client) AddLabel(ctx context.Context, issue *Issue, label string) error {
+	label = c.labelName(issue, label)
+	names := issue.labelNames()
+	if slices.Contains(names, label) {
+		c.slog.Debug("github AddLabel already labeled", "project", issue.Project(), "issue", issue.Number, "label", label)
+		return nil
+	}
+	if err := c.checkProtected(issue, label); err != nil {
+		return err
+	}
+	names = append(names, label)
+	return c.EditIssue(ctx, issue, &IssueChanges{Labels: &names})
+}
+
+// AliasLabel makes alias another name for label in the given project
+// (for example "golang/go"), for use when projects name the same
+// concept differently: after c.AliasLabel("kubernetes/kubernetes", "bug", "kind/bug"),
+// c.AddLabel(ctx, issue, "bug") adds "kind/bug" to issues in that project.
+// Aliases apply to the label names passed to [Client.AddLabel],
+// [Client.RemoveLabel], [Client.SetLabels], and [Client.EnsureLabel].
+// Names without an alias are used unchanged.
+//
+// AliasLabel must be called before the client is used to edit issues.
+func (c *Client) AliasLabel(project, alias, label string) {
+	if c.aliases == nil {
+		c.aliases = make(map[string]map[string]string)
+	}
+	if c.aliases[project] == nil {
+		c.aliases[project] = make(map[string]string)
+	}
+	c.aliases[project][alias] = label
+}
+
+// labelName returns the actual name of the label called name
+// in issue's project, following any alias set by [Client.AliasLabel].
+func (c *Client) labelName(issue *Issue, name string) string {
+	if label, ok := c.aliases[issue.Project()][name]; ok {
+		return label
+	}
+	return name
+}
+
+// ErrProtectedLabel is returned (wrapped) by [Client.AddLabel]
+// and [Client.SetLabels] when asked to add a protected label.
+// See [Client.ProtectLabels].
+var ErrProtectedLabel = errors.New("protected label")
+
+// ProtectLabels adds the named labels to the set of labels that
+// [Client.AddLabel] and [Client.SetLabels] refuse to add to issues,
+// for labels such as "release-blocker" that should only be applied by people.
+// Protected labels can still be removed, and an issue that already has
+// a protected label keeps it.
+// [Client.EditIssue] does not check protected labels.
+//
+// ProtectLabels must be called before the client is used to edit issues.
+func (c *Client) ProtectLabels(names ...string) {
+	c.protected = append(c.protected, names...)
+}
+
+// checkProtected returns an error if any of labels is protected.
+func (c *Client) checkProtected(issue *Issue, labels ...string) error {
+	for _, label := range labels {
+		if slices.Contains(c.protected, label) {
+			c.slog.Warn("github refusing protected label", "project", issue.Project(), "issue", issue.Number, "label", label)
+			return fmt.Errorf("%w %q for %s#%d", ErrProtectedLabel, label, issue.Project(), issue.Number)
+		}
+	}
+	return nil
+}
+
+// RemoveLabel removes the named label from issue on GitHub,
+// keeping the issue's other labels.
+// If the issue does not have the label, RemoveLabel does nothing.
+//
+// Like [Client.AddLabel], the check uses issue.Labels.
+func (c *Client) RemoveLabel(ctx context.Context, issue *Issue, label string) error {
+	label = c.labelName(issue, label)
+	names := issue.labelNames()
+	if !slices.Contains(names, label) {
+		c.slog.Debug("github RemoveLabel not labeled", "project", issue.Project(), "issue", issue.Number, "label", label)
+		return nil
+	}
+	names = slices.DeleteFunc(names, func(name string) bool { return name == label })
+	return c.EditIssue(ctx, issue, &IssueChanges{Labels: &names})
+}
+
+// RemoveLabelsMatching removes from issue on GitHub all the labels
+// whose names satisfy match, in a single edit,
+// and returns the names of the removed labels.
+// If no labels match, RemoveLabelsMatching does nothing.
+//
+// For example, to remove every label in the "area/" namespace,
+// match can be a glob:
+//
+//	c.RemoveLabelsMatching(ctx, issue, func(name string) bool {
+//		ok, _ := path.Match("area/*", name)
+//		return ok
+//	})
+//
+// or a regular expression:
+//
+//	c.RemoveLabelsMatching(ctx, issue, regexp.MustCompile(`^area/`).MatchString)
+//
+// Like [Client.AddLabel], RemoveLabelsMatching uses issue.Labels
+// for the current labels.
+func (c *Client) RemoveLabelsMatching(ctx context.Context, issue *Issue, match func(name string) bool) (removed []string, err error) {
+	var keep []string
+	for _, name := range issue.labelNames() {
+		if match(name) {
+			removed = append(removed, name)
+		} else {
+			keep = append(keep, name)
+		}
+	}
+	if len(removed) == 0 {
+		c.slog.Debug("github RemoveLabelsMatching no match", "project", issue.Project(), "issue", issue.Number)
+		return nil, nil
+	}
+	if keep == nil {
+		keep = []string{} // send "labels": [] to clear, not omit the field
+	}
+	if err := c.EditIssue(ctx, issue, &IssueChanges{Labels: &keep}); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// SetLabels sets the labels on issue on GitHub to exactly names,
+// in a single edit, and returns the labels it added and removed.
+// Labels that the issue already has and that are listed in names
+// are left alone. If the issue already has exactly those labels,
+// SetLabels does nothing.
+//
+// Like [Client.AddLabel], SetLabels uses issue.Labels
+// for the current labels.
+func (c *Client) SetLabels(ctx context.Context, issue *Issue, names ...string) (added, removed []string, err error) {
+	want := &Issue{}
+	for _, name := range names {
+		name = c.labelName(issue, name)
+		if !slices.ContainsFunc(want.Labels, func(l Label) bool { return l.Name == name }) {
+			want.Labels = append(want.Labels, Label{Name: name})
+		}
+	}
+	added, removed = want.DiffLabels(issue.labelNames())
+	if len(added) == 0 && len(removed) == 0 {
+		c.slog.Debug("github SetLabels unchanged", "project", issue.Project(), "issue", issue.Number)
+		return nil, nil, nil
+	}
+	if err := c.checkProtected(issue, added...); err != nil {
+		return nil, nil, err
+	}
+	labels := want.labelNames()
+	if labels == nil {
+		labels = []string{} // send "labels": [] to clear, not omit the field
+	}
+	if err := c.EditIssue(ctx, issue, &IssueChanges{Labels: &labels}); err != nil {
+		return nil, nil, err
+	}
+	return added, removed, nil
+}
+
+// SetIssueType sets the type of issue on GitHub to the named issue type
+// (for example, "Bug"). The name must be one of the issue types
+// defined by the organization that owns the issue's project,
+// ignoring case; otherwise SetIssueType returns an error
+// listing the defined types.
+// If the issue already has that type, SetIssueType does nothing.
+func (c *Client) SetIssueType(ctx context.Context, issue *Issue, name string) error {
+	if strings.EqualFold(issue.Type.Name, name) {
+		c.slog.Debug("github SetIssueType unchanged", "project", issue.Project(), "issue", issue.Number, "type", name)
+		return nil
+	}
+	org, _, _ := strings.Cut(issue.Project(), "/")
+	var types []IssueType
+	if _, err := c.get(ctx, "https://api.github.com/orgs/"+org+"/issue-types", "", &types); err != nil {
+		return fmt.Errorf("github SetIssueType: %w", err)
+	}
+	var names []string
+	for _, t := range types {
+		if strings.EqualFold(t.Name, name) {
+			return c.EditIssue(ctx, issue, &IssueChanges{Type: t.Name})
+		}
+		names = append(names, t.Name)
+	}
+	return fmt.Errorf("github SetIssueType: %s has no issue type %q (have %s)", org, name, strings.Join(names, ", "))
+}
+
+// LinkPullRequest records that pull request number pr
+// in the issue's project fixes issue, by posting a
+// “Fixed by #pr.” comment, which GitHub renders as a link.
+// If label is not empty, LinkPullRequest also adds that label
+// (for example "has-fix") to the issue, as [Client.AddLabel] does.
+// LinkPullRequest returns an error without changing the issue
+// if the pull request does not exist.
+func (c *Client) LinkPullRequest(ctx context.Context, issue *Issue, pr int64, label string) error {
+	var pull struct {
+		Number int64 `json:"number"`
+	}
+	url := fmt.Sprintf("https://api.github.com/repos/%s/pulls/%d", issue.Project(), pr)
+	if _, err := c.get(ctx, url, "", &pull); err != nil {
+		return fmt.Errorf("github LinkPullRequest: %s#%d: %w", issue.Project(), pr, err)
+	}
+	body := fmt.Sprintf("Fixed by #%d.", pull.Number)
+	if err := c.PostIssueComment(ctx, issue, &IssueCommentChanges{Body: body}); err != nil {
+		return err
+	}
+	if label != "" {
+		return c.AddLabel(ctx, issue, label)
+	}
+	return nil
+}
+
+// A LockChanges specifies how to lock an issue.
+type LockChanges struct {
+	// LockReason is the reason shown on GitHub:
+	// "off-topic", "too heated", "resolved", "spam", or empty for no reason.
+	LockReason string `json:"lock_reason,omitempty"`
+}
+
+func (ch *LockChanges) clone() *LockChanges {
+	x := *ch
+	ch = &x
+	return ch
+}
+
+// LockIssue locks the conversation on issue on GitHub,
+// so that only collaborators can comment,
+// and records the lock in issue.
+func (c *Client) LockIssue(ctx context.Context, issue *Issue, changes *LockChanges) error {
+	if c.divertEdits() {
+		c.testMu.Lock()
+		c.testEdits = append(c.testEdits, &TestingEdit{
+			Project:     issue.Project(),
+			Issue:       issue.Number,
+			LockChanges: changes.clone(),
+		})
+		c.testMu.Unlock()
+	} else if err := c.json(ctx, "PUT", issue.URL+"/lock", changes, nil); err != nil {
+		return err
+	}
+	issue.Locked = true
+	issue.ActiveLockReason = changes.LockReason
+	return nil
+}
+
+// MarkAsSpam handles a spam issue in one call: it locks the issue
+// with lock reason "spam", adds the "spam" label, and closes the issue
+// as not planned. Steps that are already done are skipped.
+// MarkAsSpam is best-effort: it attempts every step even if
+// an earlier one fails, and it returns the names of the steps
+// that succeeded ("lock", "label", "close") along with
+// the errors from any that failed, joined by [errors.Join].
+//
+// MarkAsSpam is destructive, so higher-level code should only call it
+// when that code's edits have been explicitly enabled.
+func (c *Client) MarkAsSpam(ctx context.Context, issue *Issue) (done []string, err error) {
+	var errs []error
+	step := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			return
+		}
+		done = append(done, name)
+	}
+	if !issue.Locked {
+		step("lock", c.LockIssue(ctx, issue, &LockChanges{LockReason: "spam"}))
+	} else {
+		step("lock", nil)
+	}
+	step("label", c.AddLabel(ctx, issue, "spam"))
+	if issue.State != "closed" || issue.StateReason != "not_planned" {
+		step("close", c.EditIssue(ctx, issue, &IssueChanges{State: "closed", StateReason: "not_planned"}))
+	} else {
+		step("close", nil)
+	}
+	if len(errs) > 0 {
+		err = fmt.Errorf("github MarkAsSpam %s#%d: %w", issue.Project(), issue.Number, errors.Join(errs...))
+		c.slog.Error("github MarkAsSpam", "project", issue.Project(), "issue", issue.Number, "done", done, "err", err)
+	}
+	return done, err
+}
+
+// A LabelChanges describes a new label to create in a project.
+type LabelChanges struct {
+	Name        string `json:"name"`
+	Color       string `json:"color,omitempty"` // hex RGB without leading #, like "d73a4a"
+	Description string `json:"description,omitempty"`
+}
+
+func (ch *LabelChanges) clone() *LabelChanges {
+	x := *ch
+	ch = &x
+	return ch
+}
+
+// CreateLabel creates a new label in the given project (for example "golang/go").
+func (c *Client) CreateLabel(ctx context.Context, project string, changes *LabelChanges) error {
+	if c.divertEdits() {
+		c.testMu.Lock()
+		defer c.testMu.Unlock()
+
+		c.testEdits = append(c.testEdits, &TestingEdit{
+			Project:      project,
+			LabelChanges: changes.clone(),
+		})
 		return nil
 	}
 
-	return c.patch(issue.URL, changes)
+	return c.post(ctx, "https://api.github.com/repos/"+project+"/labels", changes)
+}
+
+// EnsureLabel adds the named label to issue on GitHub,
+// first creating the label in the issue's project with the given
+// color and description if the project does not have it yet.
+// Creating labels requires more privileges than applying them,
+// so callers should only use EnsureLabel when they mean to
+// introduce new labels; [Client.AddLabel] is usually enough.
+//
+// EnsureLabel fetches the project's labels the first time it is
+// called for that project and remembers them for later calls.
+// Like GitHub, it matches label names ignoring case:
+// if the project has a label "Bug", EnsureLabel(ctx, issue, "bug", ...)
+// adds "Bug" without creating a new label.
+func (c *Client) EnsureLabel(ctx context.Context, issue *Issue, name, color, description string) error {
+	project := issue.Project()
+	name = c.labelName(issue, name)
+	if err := c.checkProtected(issue, name); err != nil {
+		return err
+	}
+
+	names, err := c.projectLabels(ctx, project)
+	if err != nil {
+		return fmt.Errorf("github EnsureLabel: %w", err)
+	}
+	if i := slices.IndexFunc(names, func(n string) bool { return strings.EqualFold(n, name) }); i >= 0 {
+		name = names[i]
+	} else {
+		c.slog.Info("github create label", "project", project, "label", name)
+		if err := c.CreateLabel(ctx, project, &LabelChanges{Name: name, Color: color, Description: description}); err != nil {
+			return err
+		}
+		c.labelMu.Lock()
+		c.labels[project] = append(c.labels[project], name)
+		c.labelMu.Unlock()
+	}
+	return c.AddLabel(ctx, issue, name)
+}
+
+// projectLabels returns the names of the labels in project,
+// fetching them from GitHub the first time and caching them after that.
+// It does not hold c.labelMu while fetching.
+func (c *Client) projectLabels(ctx context.Context, project string) ([]string, error) {
+	c.labelMu.Lock()
+	names, ok := c.labels[project]
+	c.labelMu.Unlock()
+	if ok {
+		return names, nil
+	}
+
+	for p, err := range c.pages(ctx, "https://api.github.com/repos/"+project+"/labels?per_page=100", "") {
+		if err != nil {
+			return nil, err
+		}
+		for _, js := range p.body {
+			var l Label
+			if err := json.Unmarshal(js, &l); err != nil {
+				return nil, err
+			}
+			names = append(names, l.Name)
+		}
+	}
+
+	c.labelMu.Lock()
+	defer c.labelMu.Unlock()
+	if cached, ok := c.labels[project]; ok {
+		return cached, nil // fetched concurrently
+	}
+	if c.labels == nil {
+		c.labels = make(map[string][]string)
+	}
+	c.labels[project] = names
+	return names, nil
 }
 
 // patch is like c.get but makes a PATCH request.
 // Unlike c.get, it requires authentication.
-func (c *Client) patch(url string, changes any) error {
-	return c.json("PATCH", url, changes)
+func (c *Client) patch(ctx context.Context, url string, changes any) error {
+	return c.json(ctx, "PATCH", url, changes, nil)
 }
 
 // post is like c.get but makes a POST request.
 // Unlike c.get, it requires authentication.
-func (c *Client) post(url string, body any) error {
-	return c.json("POST", url, body)
+func (c *Client) post(ctx context.Context, url string, body any) error {
+	return c.json(ctx, "POST", url, body, nil)
 }
 
 // json is the general PATCH/POST implementation.
-func (c *Client) json(method, url string, body any) error {
+// If reply is not nil, json decodes the response body into reply.
+func (c *Client) json(ctx context.Context, method, url string, body, reply any) error {
 	js, err := json.Marshal(body)
 	if err != nil {
 		return err
@@ -162,7 +700,7 @@ func (c *Client) json(method, url string, body any) error {
 	user, pass, _ := strings.Cut(auth, ":")
 
 Redo:
-	req, err := http.NewRequest(method, url, bytes.NewReader(js))
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(js))
 	if err != nil {
 		return err
 	}
@@ -183,5 +721,10 @@ Redo:
 	if resp.StatusCode/10 != 20 { // allow 200, 201, maybe others
 		return fmt.Errorf("%s\n%s", resp.Status, data)
 	}
+	if reply != nil {
+		if err := json.Unmarshal(data, reply); err != nil {
+			return fmt.Errorf("decoding response: %v", err)
+		}
+	}
 	return nil
 }
@@ -5,8 +5,17 @@
 package github
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
 	"slices"
+	"strings"
+	"sync"
 	"testing"
 
 	"golang.org/x/oscar/internal/httprr"
@@ -16,6 +25,7 @@ import (
 )
 
 func TestMarkdownEditing(t *testing.T) {
+	ctx := context.Background()
 	check := testutil.Checker(t)
 	lg := testutil.Slogger(t)
 	db := storage.MemDB()
@@ -30,7 +40,7 @@ func TestMarkdownEditing(t *testing.T) {
 	}
 	c := New(lg, db, sdb, rr.Client())
 	check(c.Add("rsc/tmp"))
-	check(c.Sync())
+	check(c.Sync(ctx))
 
 	var ei, ec *Event
 	for e := range c.Events("rsc/tmp", 5, 5) {
@@ -49,26 +59,27 @@ func TestMarkdownEditing(t *testing.T) {
 	}
 
 	issue := ei.Typed.(*Issue)
-	issue1, err := c.DownloadIssue(issue.URL)
+	issue1, err := c.DownloadIssue(ctx, issue.URL)
 	check(err)
 	if issue1.Title != issue.Title {
 		t.Errorf("DownloadIssue: Title=%q, want %q", issue1.Title, issue.Title)
 	}
 
 	comment := ec.Typed.(*IssueComment)
-	comment1, err := c.DownloadIssueComment(comment.URL)
+	comment1, err := c.DownloadIssueComment(ctx, comment.URL)
 	check(err)
 	if comment1.Body != comment.Body {
 		t.Errorf("DownloadIssueComment: Body=%q, want %q", comment1.Body, comment.Body)
 	}
 
 	c.testing = false // edit github directly (except for the httprr in the way)
-	check(c.EditIssueComment(comment, &IssueCommentChanges{Body: rot13(comment.Body)}))
-	check(c.PostIssueComment(issue, &IssueCommentChanges{Body: "testing. rot13 is the best."}))
-	check(c.EditIssue(issue, &IssueChanges{Title: rot13(issue.Title)}))
+	check(c.EditIssueComment(ctx, comment, &IssueCommentChanges{Body: rot13(comment.Body)}))
+	check(c.PostIssueComment(ctx, issue, &IssueCommentChanges{Body: "testing. rot13 is the best."}))
+	check(c.EditIssue(ctx, issue, &IssueChanges{Title: rot13(issue.Title)}))
 }
 
 func TestMarkdownDivertEdit(t *testing.T) {
+	ctx := context.Background()
 	check := testutil.Checker(t)
 	lg := testutil.Slogger(t)
 	db := storage.MemDB()
@@ -93,22 +104,22 @@ func TestMarkdownDivertEdit(t *testing.T) {
 	}
 
 	issue := ei.Typed.(*Issue)
-	issue1, err := c.DownloadIssue(issue.URL)
+	issue1, err := c.DownloadIssue(ctx, issue.URL)
 	check(err)
 	if issue1.Title != issue.Title {
 		t.Errorf("DownloadIssue: Title=%q, want %q", issue1.Title, issue.Title)
 	}
 
 	comment := ec.Typed.(*IssueComment)
-	comment1, err := c.DownloadIssueComment(comment.URL)
+	comment1, err := c.DownloadIssueComment(ctx, comment.URL)
 	check(err)
 	if comment1.Body != comment.Body {
 		t.Errorf("DownloadIssueComment: Body=%q, want %q", comment1.Body, comment.Body)
 	}
 
-	check(c.EditIssueComment(comment, &IssueCommentChanges{Body: rot13(comment.Body)}))
-	check(c.PostIssueComment(issue, &IssueCommentChanges{Body: "testing. rot13 is the best."}))
-	check(c.EditIssue(issue, &IssueChanges{Title: rot13(issue.Title), Labels: &[]string{"ebg13"}}))
+	check(c.EditIssueComment(ctx, comment, &IssueCommentChanges{Body: rot13(comment.Body)}))
+	check(c.PostIssueComment(ctx, issue, &IssueCommentChanges{Body: "testing. rot13 is the best."}))
+	check(c.EditIssue(ctx, issue, &IssueChanges{Title: rot13(issue.Title), Labels: &[]string{"ebg13"}}))
 
 	var edits []string
 	for _, e := range c.Testing().Edits() {
@@ -136,3 +147,527 @@ func rot13(s string) string {
 	}
 	return string(b)
 }
+
+func TestSearchIssues(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	lg, out := testutil.SlogBuffer()
+	c := New(lg, storage.MemDB(), nil, nil)
+
+	const query = "repo:rsc/tmp is:open"
+	url := "https://api.github.com/search/issues?page=1&per_page=100&q=repo%3Arsc%2Ftmp+is%3Aopen"
+	c.testEvents = map[string]json.RawMessage{
+		url: json.RawMessage(`{"total_count":2,"items":[{"number":1,"title":"one"},{"number":2,"title":"two"}]}`),
+	}
+	issues, err := c.SearchIssues(ctx, query)
+	check(err)
+	var titles []string
+	for _, issue := range issues {
+		titles = append(titles, issue.Title)
+	}
+	if want := []string{"one", "two"}; !slices.Equal(titles, want) {
+		t.Errorf("SearchIssues titles = %q, want %q", titles, want)
+	}
+	if strings.Contains(out.String(), "github search truncated") {
+		t.Errorf("SearchIssues logged truncation warning for small result:\n%s", out)
+	}
+
+	c.testEvents[url] = json.RawMessage(`{"total_count":1234,"items":[{"number":1,"title":"one"}]}`)
+	_, err = c.SearchIssues(ctx, query)
+	check(err)
+	if !strings.Contains(out.String(), "github search truncated") {
+		t.Errorf("SearchIssues did not log truncation warning:\n%s", out)
+	}
+}
+
+func TestAddRemoveLabel(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	issue := &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/1",
+		Number: 1,
+		Labels: []Label{{Name: "a"}, {Name: "b"}},
+	}
+
+	// No-ops must not make any GitHub requests.
+	check(c.AddLabel(ctx, issue, "a"))
+	check(c.RemoveLabel(ctx, issue, "c"))
+	if edits := c.Testing().Edits(); len(edits) != 0 {
+		t.Fatalf("no-op AddLabel, RemoveLabel made edits: %v", edits)
+	}
+
+	check(c.AddLabel(ctx, issue, "c"))
+	check(c.RemoveLabel(ctx, issue, "a"))
+	var edits []string
+	for _, e := range c.Testing().Edits() {
+		edits = append(edits, e.String())
+	}
+	want := []string{
+		`EditIssue(rsc/tmp#1, {"labels":["a","b","c"]})`,
+		`EditIssue(rsc/tmp#1, {"labels":["b","c"]})`,
+	}
+	if !slices.Equal(edits, want) {
+		t.Fatalf("Testing().Edits():\nhave %s\nwant %s", edits, want)
+	}
+	if names := issue.labelNames(); !slices.Equal(names, []string{"b", "c"}) {
+		t.Errorf("issue.Labels = %q after edits, want [b c]", names)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	c.testEvents = map[string]json.RawMessage{
+		"https://api.github.com/user": json.RawMessage(`{"login":"gabyhelp"}`),
+	}
+	login, err := c.Login(ctx)
+	check(err)
+	if login != "gabyhelp" {
+		t.Errorf("Login() = %q, want %q", login, "gabyhelp")
+	}
+}
+
+func TestRemoveLabelsMatching(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	issue := &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/1",
+		Number: 1,
+		Labels: []Label{{Name: "area/compiler"}, {Name: "NeedsFix"}, {Name: "area/runtime"}},
+	}
+	glob := func(pattern string) func(string) bool {
+		return func(name string) bool {
+			ok, _ := path.Match(pattern, name)
+			return ok
+		}
+	}
+
+	removed, err := c.RemoveLabelsMatching(ctx, issue, glob("os/*"))
+	check(err)
+	if removed != nil || len(c.Testing().Edits()) != 0 {
+		t.Fatalf("RemoveLabelsMatching(os/*) = %q with edits %v, want no-op", removed, c.Testing().Edits())
+	}
+
+	removed, err = c.RemoveLabelsMatching(ctx, issue, glob("area/*"))
+	check(err)
+	if want := []string{"area/compiler", "area/runtime"}; !slices.Equal(removed, want) {
+		t.Errorf("RemoveLabelsMatching(area/*) = %q, want %q", removed, want)
+	}
+
+	removed, err = c.RemoveLabelsMatching(ctx, issue, regexp.MustCompile(`^Needs|compiler$`).MatchString)
+	check(err)
+	if want := []string{"NeedsFix"}; !slices.Equal(removed, want) {
+		t.Errorf("RemoveLabelsMatching(regexp) = %q, want %q", removed, want)
+	}
+
+	// No labels are left, so there is nothing to remove.
+	removed, err = c.RemoveLabelsMatching(ctx, issue, func(string) bool { return true })
+	check(err)
+	if removed != nil {
+		t.Errorf("RemoveLabelsMatching(all) = %q, want no-op", removed)
+	}
+
+	var edits []string
+	for _, e := range c.Testing().Edits() {
+		edits = append(edits, e.String())
+	}
+	want := []string{
+		`EditIssue(rsc/tmp#1, {"labels":["NeedsFix"]})`,
+		`EditIssue(rsc/tmp#1, {"labels":[]})`,
+	}
+	if !slices.Equal(edits, want) {
+		t.Fatalf("Testing().Edits():\nhave %s\nwant %s", edits, want)
+	}
+	if names := issue.labelNames(); !slices.Equal(names, nil) {
+		t.Errorf("issue.Labels = %q after edits, want []", names)
+	}
+}
+
+func TestSetLabels(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	issue := &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/1",
+		Number: 1,
+		Labels: []Label{{Name: "a"}, {Name: "b"}},
+	}
+
+	// Same labels in a different order, with a duplicate: no edit.
+	added, removed, err := c.SetLabels(ctx, issue, "b", "a", "b")
+	check(err)
+	if added != nil || removed != nil || len(c.Testing().Edits()) != 0 {
+		t.Fatalf("SetLabels(b, a, b) = %q, %q with edits %v, want no-op", added, removed, c.Testing().Edits())
+	}
+
+	added, removed, err = c.SetLabels(ctx, issue, "b", "c")
+	check(err)
+	if !slices.Equal(added, []string{"c"}) || !slices.Equal(removed, []string{"a"}) {
+		t.Errorf("SetLabels(b, c) = %q, %q, want [c], [a]", added, removed)
+	}
+
+	added, removed, err = c.SetLabels(ctx, issue)
+	check(err)
+	if added != nil || !slices.Equal(removed, []string{"b", "c"}) {
+		t.Errorf("SetLabels() = %q, %q, want [], [b c]", added, removed)
+	}
+
+	var edits []string
+	for _, e := range c.Testing().Edits() {
+		edits = append(edits, e.String())
+	}
+	want := []string{
+		`EditIssue(rsc/tmp#1, {"labels":["b","c"]})`,
+		`EditIssue(rsc/tmp#1, {"labels":[]})`,
+	}
+	if !slices.Equal(edits, want) {
+		t.Fatalf("Testing().Edits():\nhave %s\nwant %s", edits, want)
+	}
+	if names := issue.labelNames(); !slices.Equal(names, nil) {
+		t.Errorf("issue.Labels = %q after edits, want []", names)
+	}
+}
+
+func TestProtectLabels(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	c.ProtectLabels("release-blocker", "Security")
+	issue := &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/1",
+		Number: 1,
+		Labels: []Label{{Name: "Security"}},
+	}
+
+	if err := c.AddLabel(ctx, issue, "release-blocker"); !errors.Is(err, ErrProtectedLabel) {
+		t.Errorf("AddLabel(release-blocker) = %v, want ErrProtectedLabel", err)
+	}
+	if _, _, err := c.SetLabels(ctx, issue, "Security", "release-blocker"); !errors.Is(err, ErrProtectedLabel) {
+		t.Errorf("SetLabels(Security, release-blocker) = %v, want ErrProtectedLabel", err)
+	}
+	if edits := c.Testing().Edits(); len(edits) != 0 {
+		t.Fatalf("protected labels were added: %v", edits)
+	}
+
+	// Already-present protected labels can be kept or removed,
+	// and unprotected labels can be added.
+	check(c.AddLabel(ctx, issue, "Security"))
+	_, _, err := c.SetLabels(ctx, issue, "Security", "NeedsFix")
+	check(err)
+	check(c.RemoveLabel(ctx, issue, "Security"))
+
+	var edits []string
+	for _, e := range c.Testing().Edits() {
+		edits = append(edits, e.String())
+	}
+	want := []string{
+		`EditIssue(rsc/tmp#1, {"labels":["Security","NeedsFix"]})`,
+		`EditIssue(rsc/tmp#1, {"labels":["NeedsFix"]})`,
+	}
+	if !slices.Equal(edits, want) {
+		t.Fatalf("Testing().Edits():\nhave %s\nwant %s", edits, want)
+	}
+	if names := issue.labelNames(); !slices.Equal(names, []string{"NeedsFix"}) {
+		t.Errorf("issue.Labels = %q after edits, want [NeedsFix]", names)
+	}
+}
+
+func TestSetIssueType(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	c.testEvents = map[string]json.RawMessage{
+		"https://api.github.com/orgs/rsc/issue-types": json.RawMessage(`[{"id":1,"name":"Bug"},{"id":2,"name":"Feature"}]`),
+	}
+	issue := &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/1",
+		Number: 1,
+		Type:   IssueType{Name: "Bug"},
+	}
+
+	check(c.SetIssueType(ctx, issue, "bug"))
+	check(c.SetIssueType(ctx, issue, "feature"))
+	err := c.SetIssueType(ctx, issue, "Task")
+	if err == nil || !strings.Contains(err.Error(), `no issue type "Task" (have Bug, Feature)`) {
+		t.Errorf("SetIssueType(Task) = %v, want unknown type error", err)
+	}
+
+	var edits []string
+	for _, e := range c.Testing().Edits() {
+		edits = append(edits, e.String())
+	}
+	want := []string{
+		`EditIssue(rsc/tmp#1, {"type":"Feature"})`,
+	}
+	if !slices.Equal(edits, want) {
+		t.Fatalf("Testing().Edits():\nhave %s\nwant %s", edits, want)
+	}
+}
+
+func TestMarkAsSpam(t *testing.T) {
+	ctx := context.Background()
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	issue := &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/1",
+		Number: 1,
+		State:  "open",
+		Labels: []Label{{Name: "a"}},
+	}
+
+	all := []string{"lock", "label", "close"}
+	done, err := c.MarkAsSpam(ctx, issue)
+	if err != nil || !slices.Equal(done, all) {
+		t.Fatalf("MarkAsSpam() = %q, %v, want %q, nil", done, err, all)
+	}
+	if !issue.Locked || issue.ActiveLockReason != "spam" || issue.State != "closed" || issue.StateReason != "not_planned" {
+		t.Errorf("after MarkAsSpam, issue = %+v, want locked as spam and closed as not planned", issue)
+	}
+
+	// Everything is done, so a second call makes no edits.
+	done, err = c.MarkAsSpam(ctx, issue)
+	if err != nil || !slices.Equal(done, all) {
+		t.Fatalf("second MarkAsSpam() = %q, %v, want %q, nil", done, err, all)
+	}
+
+	var edits []string
+	for _, e := range c.Testing().Edits() {
+		edits = append(edits, e.String())
+	}
+	want := []string{
+		`LockIssue(rsc/tmp#1, {"lock_reason":"spam"})`,
+		`EditIssue(rsc/tmp#1, {"labels":["a","spam"]})`,
+		`EditIssue(rsc/tmp#1, {"state":"closed","state_reason":"not_planned"})`,
+	}
+	if !slices.Equal(edits, want) {
+		t.Fatalf("Testing().Edits():\nhave %s\nwant %s", edits, want)
+	}
+
+	// A failed step does not stop the others.
+	// Here the stale check fails the edits but not the lock.
+	c = New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	c.EnableStaleCheck()
+	c.testEvents = map[string]json.RawMessage{
+		issue.URL: json.RawMessage(`{"number":1,"updated_at":"2024-06-02T00:00:00Z"}`),
+	}
+	issue = &Issue{URL: issue.URL, Number: 1, State: "open", UpdatedAt: "2024-06-01T00:00:00Z"}
+	done, err = c.MarkAsSpam(ctx, issue)
+	if !errors.Is(err, ErrStaleIssue) || !slices.Equal(done, []string{"lock"}) {
+		t.Errorf("MarkAsSpam(stale) = %q, %v, want [lock], ErrStaleIssue", done, err)
+	}
+}
+
+// statusTransport is an [http.RoundTripper] that answers
+// every request with an empty response with the given status code.
+type statusTransport int
+
+func (code statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: int(code),
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(int(code))),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+func TestLinkPullRequest(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), secret.Empty(), &http.Client{Transport: statusTransport(http.StatusNotFound)})
+	c.testEvents = map[string]json.RawMessage{
+		"https://api.github.com/repos/rsc/tmp/pulls/5": json.RawMessage(`{"number":5}`),
+		"https://api.github.com/repos/rsc/tmp/pulls/6": json.RawMessage(`{"number":6}`),
+	}
+	issue := &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/1",
+		Number: 1,
+		Labels: []Label{{Name: "NeedsFix"}},
+	}
+
+	check(c.LinkPullRequest(ctx, issue, 5, ""))
+	check(c.LinkPullRequest(ctx, issue, 6, "has-fix"))
+	if err := c.LinkPullRequest(ctx, issue, 7, "has-fix"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("LinkPullRequest(missing PR) = %v, want 404 error", err)
+	}
+
+	var edits []string
+	for _, e := range c.Testing().Edits() {
+		edits = append(edits, e.String())
+	}
+	want := []string{
+		`PostIssueComment(rsc/tmp#1, {"body":"Fixed by #5."})`,
+		`PostIssueComment(rsc/tmp#1, {"body":"Fixed by #6."})`,
+		`EditIssue(rsc/tmp#1, {"labels":["NeedsFix","has-fix"]})`,
+	}
+	if !slices.Equal(edits, want) {
+		t.Fatalf("Testing().Edits():\nhave %s\nwant %s", edits, want)
+	}
+}
+
+func TestEnsureLabel(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	c.testEvents = map[string]json.RawMessage{
+		"https://api.github.com/repos/rsc/tmp/labels?per_page=100": json.RawMessage(`[{"name":"a"},{"name":"Bug"}]`),
+	}
+	issue := &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/1",
+		Number: 1,
+	}
+
+	check(c.EnsureLabel(ctx, issue, "a", "ededed", "existing"))
+	check(c.EnsureLabel(ctx, issue, "new", "d73a4a", "a new label"))
+
+	// The label list is cached, and the new label is remembered.
+	delete(c.testEvents, "https://api.github.com/repos/rsc/tmp/labels?per_page=100")
+	issue2 := &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/2",
+		Number: 2,
+	}
+	check(c.EnsureLabel(ctx, issue2, "new", "d73a4a", "a new label"))
+
+	// Label names match ignoring case, as on GitHub.
+	check(c.EnsureLabel(ctx, issue2, "bug", "d73a4a", "not used"))
+	check(c.EnsureLabel(ctx, issue2, "NEW", "d73a4a", "not used"))
+
+	var edits []string
+	for _, e := range c.Testing().Edits() {
+		edits = append(edits, e.String())
+	}
+	want := []string{
+		`EditIssue(rsc/tmp#1, {"labels":["a"]})`,
+		`CreateLabel(rsc/tmp, {"name":"new","color":"d73a4a","description":"a new label"})`,
+		`EditIssue(rsc/tmp#1, {"labels":["a","new"]})`,
+		`EditIssue(rsc/tmp#2, {"labels":["new"]})`,
+		`EditIssue(rsc/tmp#2, {"labels":["new","Bug"]})`,
+	}
+	if !slices.Equal(edits, want) {
+		t.Fatalf("Testing().Edits():\nhave %s\nwant %s", edits, want)
+	}
+}
+
+func TestStaleCheck(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	c.EnableStaleCheck()
+	const url = "https://api.github.com/repos/rsc/tmp/issues/1"
+	issue := &Issue{
+		URL:       url,
+		Number:    1,
+		UpdatedAt: "2024-06-01T00:00:00Z",
+		Labels:    []Label{{Name: "a"}},
+	}
+
+	// Unchanged on GitHub: edit goes through.
+	c.testEvents = map[string]json.RawMessage{
+		url: json.RawMessage(`{"number":1,"updated_at":"2024-06-01T00:00:00Z","labels":[{"name":"a"}]}`),
+	}
+	check(c.AddLabel(ctx, issue, "b"))
+
+	// Someone added a label on GitHub: edit is skipped.
+	c.testEvents[url] = json.RawMessage(`{"number":1,"updated_at":"2024-06-02T00:00:00Z","labels":[{"name":"a"},{"name":"x"}]}`)
+	if err := c.AddLabel(ctx, issue, "c"); !errors.Is(err, ErrStaleIssue) {
+		t.Errorf("AddLabel on changed issue = %v, want ErrStaleIssue", err)
+	}
+
+	var edits []string
+	for _, e := range c.Testing().Edits() {
+		edits = append(edits, e.String())
+	}
+	want := []string{
+		`EditIssue(rsc/tmp#1, {"labels":["a","b"]})`,
+	}
+	if !slices.Equal(edits, want) {
+		t.Fatalf("Testing().Edits():\nhave %s\nwant %s", edits, want)
+	}
+}
+
+func TestStaleCheckSequence(t *testing.T) {
+	// A fake GitHub that records each PATCH and bumps updated_at.
+	var mu sync.Mutex
+	live := &Issue{Number: 1, UpdatedAt: "2024-06-01T00:00:00Z", Labels: []Label{{Name: "a"}}}
+	edits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == "PATCH" {
+			var changes IssueChanges
+			if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			live.apply(&changes)
+			edits++
+			live.UpdatedAt = fmt.Sprintf("2024-06-01T00:00:%02dZ", edits)
+		}
+		js, _ := json.Marshal(live)
+		w.Write(js)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), secret.Empty(), srv.Client())
+	c.testing = false // talk to srv
+	c.EnableStaleCheck()
+	live.URL = srv.URL + "/repos/rsc/tmp/issues/1"
+	issue := *live
+
+	// Each edit refreshes issue from the PATCH response,
+	// so later edits do not see the issue as stale.
+	check(c.AddLabel(ctx, &issue, "b"))
+	check(c.AddLabel(ctx, &issue, "c"))
+	check(c.RemoveLabel(ctx, &issue, "a"))
+
+	if edits != 3 {
+		t.Errorf("made %d edits, want 3", edits)
+	}
+	if names := issue.labelNames(); !slices.Equal(names, []string{"b", "c"}) {
+		t.Errorf("issue.Labels = %q after edits, want [b c]", names)
+	}
+	if names := live.labelNames(); !slices.Equal(names, []string{"b", "c"}) {
+		t.Errorf("GitHub labels = %q after edits, want [b c]", names)
+	}
+	if issue.UpdatedAt != live.UpdatedAt {
+		t.Errorf("issue.UpdatedAt = %s, want %s", issue.UpdatedAt, live.UpdatedAt)
+	}
+}
+
+func TestAliasLabel(t *testing.T) {
+	ctx := context.Background()
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	c.AliasLabel("rsc/tmp", "bug", "kind/bug")
+	c.AliasLabel("rsc/other", "bug", "Bug")
+	issue := &Issue{
+		URL:    "https://api.github.com/repos/rsc/tmp/issues/1",
+		Number: 1,
+		Labels: []Label{{Name: "kind/bug"}},
+	}
+
+	check(c.AddLabel(ctx, issue, "bug")) // already has kind/bug
+	check(c.AddLabel(ctx, issue, "NeedsFix"))
+	check(c.RemoveLabel(ctx, issue, "bug"))
+	_, _, err := c.SetLabels(ctx, issue, "bug", "Bug")
+	check(err)
+
+	var edits []string
+	for _, e := range c.Testing().Edits() {
+		edits = append(edits, e.String())
+	}
+	want := []string{
+		`EditIssue(rsc/tmp#1, {"labels":["kind/bug","NeedsFix"]})`,
+		`EditIssue(rsc/tmp#1, {"labels":["NeedsFix"]})`,
+		`EditIssue(rsc/tmp#1, {"labels":["kind/bug","Bug"]})`,
+	}
+	if !slices.Equal(edits, want) {
+		t.Fatalf("Testing().Edits():\nhave %s\nwant %s", edits, want)
+	}
+	if names := issue.labelNames(); !slices.Equal(names, []string{"kind/bug", "Bug"}) {
+		t.Errorf("issue.Labels = %q after edits, want [kind/bug Bug]", names)
+	}
+}
@@ -6,10 +6,12 @@ package github
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"iter"
 	"net/http"
 	"slices"
+	"sync"
 	"testing"
 
 	"golang.org/x/oscar/internal/httprr"
@@ -20,6 +22,7 @@ import (
 )
 
 func TestMarkdown(t *testing.T) {
+	ctx := context.Background()
 	check := testutil.Checker(t)
 	lg := testutil.Slogger(t)
 	db := storage.MemDB()
@@ -34,7 +37,7 @@ func TestMarkdown(t *testing.T) {
 	}
 	c := New(lg, db, sdb, rr.Client())
 	check(c.Add("rsc/markdown"))
-	check(c.Sync())
+	check(c.Sync(ctx))
 
 	w := c.EventWatcher("test1")
 	for e := range w.Recent() {
@@ -50,7 +53,7 @@ func TestMarkdown(t *testing.T) {
 		sdb = secret.Netrc()
 	}
 	c = New(lg, db, sdb, rr.Client())
-	check(c.Sync())
+	check(c.Sync(ctx))
 
 	// Test that EventWatcher sees the updates.
 	diffEvents(t,
@@ -71,12 +74,13 @@ func TestMarkdown(t *testing.T) {
 		sdb = secret.Netrc()
 	}
 	c = New(lg, db, sdb, rr.Client())
-	check(c.Sync())
+	check(c.Sync(ctx))
 
 	testMarkdownEvents(t, c)
 }
 
 func TestMarkdownIncrementalSync(t *testing.T) {
+	ctx := context.Background()
 	check := testutil.Checker(t)
 	lg := testutil.Slogger(t)
 	db := storage.MemDB()
@@ -97,7 +101,7 @@ func TestMarkdownIncrementalSync(t *testing.T) {
 		testFullSyncStop = nil
 	}()
 	for {
-		err := c.Sync()
+		err := c.Sync(ctx)
 		if err == nil {
 			break
 		}
@@ -192,6 +196,7 @@ func collectEventsAfter(t *testing.T, dbtime timed.DBTime, seq iter.Seq[*Event])
 }
 
 func TestIvy(t *testing.T) {
+	ctx := context.Background()
 	check := testutil.Checker(t)
 	lg := testutil.Slogger(t)
 	db := storage.MemDB()
@@ -204,10 +209,11 @@ func TestIvy(t *testing.T) {
 	}
 	c := New(lg, db, sdb, rr.Client())
 	check(c.Add("robpike/ivy"))
-	check(c.Sync())
+	check(c.Sync(ctx))
 }
 
 func TestOmap(t *testing.T) {
+	ctx := context.Background()
 	check := testutil.Checker(t)
 	lg := testutil.Slogger(t)
 	db := storage.MemDB()
@@ -220,7 +226,7 @@ func TestOmap(t *testing.T) {
 	}
 	c := New(lg, db, sdb, rr.Client())
 	check(c.Add("rsc/omap"))
-	check(c.Sync())
+	check(c.Sync(ctx))
 }
 
 var markdownEarlyEvents = [][]byte{
@@ -324,3 +330,46 @@ var markdownEvents = [][]byte{
 	o("rsc/markdown", 19, "/issues", 2308816936),
 	o("rsc/markdown", 19, "/issues/comments", 2146197528),
 }
+
+// blockTransport is an [http.RoundTripper] whose requests wait
+// until their contexts are canceled.
+// It closes started when the first request arrives.
+type blockTransport struct {
+	once    sync.Once
+	started chan struct{}
+}
+
+func (t *blockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.once.Do(func() { close(t.started) })
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestSyncCancel(t *testing.T) {
+	check := testutil.Checker(t)
+	tr := &blockTransport{started: make(chan struct{})}
+	c := New(testutil.Slogger(t), storage.MemDB(), secret.Empty(), &http.Client{Transport: tr})
+	check(c.Add("rsc/markdown"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-tr.started
+		cancel()
+	}()
+	if err := c.Sync(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Sync with canceled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestProjects(t *testing.T) {
+	check := testutil.Checker(t)
+	c := New(testutil.Slogger(t), storage.MemDB(), nil, nil)
+	if list := c.Projects(); list != nil {
+		t.Errorf("Projects() = %q before Add, want none", list)
+	}
+	check(c.Add("rsc/tmp"))
+	check(c.Add("golang/go"))
+	if list, want := c.Projects(), []string{"golang/go", "rsc/tmp"}; !slices.Equal(list, want) {
+		t.Errorf("Projects() = %q, want %q", list, want)
+	}
+}
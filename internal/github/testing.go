@@ -11,7 +11,6 @@ import (
 	"strconv"
 	"strings"
 	"sync/atomic"
-	"testing"
 	"time"
 
 	"golang.org/x/oscar/internal/storage"
@@ -27,7 +26,7 @@ import (
 //
 // Each Client has only one TestingClient associated with it. Every call to Testing returns the same TestingClient.
 func (c *Client) Testing() *TestingClient {
-	if !testing.Testing() {
+	if !c.testing {
 		return nil
 	}
 
@@ -54,6 +53,8 @@ type TestingEdit struct {
 	Comment             int64
 	IssueChanges        *IssueChanges
 	IssueCommentChanges *IssueCommentChanges
+	LabelChanges        *LabelChanges
+	LockChanges         *LockChanges
 }
 
 // String returns a basic string representation of the edit.
@@ -72,6 +73,14 @@ func (e *TestingEdit) String() string {
 			return fmt.Sprintf("PostIssueComment(%s#%d, %s)", e.Project, e.Issue, js)
 		}
 		return fmt.Sprintf("EditIssueComment(%s#%d.%d, %s)", e.Project, e.Issue, e.Comment, js)
+
+	case e.LabelChanges != nil:
+		js, _ := json.Marshal(e.LabelChanges)
+		return fmt.Sprintf("CreateLabel(%s, %s)", e.Project, js)
+
+	case e.LockChanges != nil:
+		js, _ := json.Marshal(e.LockChanges)
+		return fmt.Sprintf("LockIssue(%s#%d, %s)", e.Project, e.Issue, js)
 	}
 	return "?"
 }
@@ -0,0 +1,52 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxWebhookBody is the largest webhook payload GitHub sends (25 MB).
+const maxWebhookBody = 25 << 20
+
+// ValidateWebhookRequest reads the body of the GitHub webhook request r
+// and checks that its X-Hub-Signature-256 header is the HMAC-SHA256
+// signature of the body using the webhook secret key.
+// If so, it returns the event type from the X-GitHub-Event header
+// (for example "issues" or "issue_comment") along with the body,
+// which is the JSON event payload.
+//
+// See https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries.
+func ValidateWebhookRequest(r *http.Request, key []byte) (event string, body []byte, err error) {
+	if len(key) == 0 {
+		// An empty key would accept payloads signed by anyone.
+		return "", nil, errors.New("github webhook: missing secret key")
+	}
+	sig, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !ok {
+		return "", nil, errors.New("github webhook: missing X-Hub-Signature-256 header")
+	}
+	want, err := hex.DecodeString(sig)
+	if err != nil {
+		return "", nil, fmt.Errorf("github webhook: malformed signature: %v", err)
+	}
+	body, err = io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		return "", nil, fmt.Errorf("github webhook: reading body: %v", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), want) {
+		return "", nil, errors.New("github webhook: signature mismatch")
+	}
+	return r.Header.Get("X-GitHub-Event"), body, nil
+}
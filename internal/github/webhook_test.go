@@ -0,0 +1,58 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateWebhookRequest(t *testing.T) {
+	const payload = `{"action":"opened","issue":{"number":1}}`
+	key := []byte("secret")
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	good := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, tt := range []struct {
+		name string
+		sig  string
+		key  string
+		ok   bool
+	}{
+		{"good", good, "secret", true},
+		{"wrongkey", good, "other", false},
+		{"nokey", good, "", false},
+		{"nosig", "", "secret", false},
+		{"sha1", "sha1=" + good[len("sha256="):], "secret", false},
+		{"nothex", "sha256=zz", "secret", false},
+		{"mismatch", "sha256=00", "secret", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/webhook", strings.NewReader(payload))
+			r.Header.Set("X-GitHub-Event", "issues")
+			if tt.sig != "" {
+				r.Header.Set("X-Hub-Signature-256", tt.sig)
+			}
+			event, body, err := ValidateWebhookRequest(r, []byte(tt.key))
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("ValidateWebhookRequest succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event != "issues" || string(body) != payload {
+				t.Fatalf("ValidateWebhookRequest = %q, %q, want %q, %q", event, body, "issues", payload)
+			}
+		})
+	}
+}
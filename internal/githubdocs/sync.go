@@ -9,6 +9,9 @@ package githubdocs
 import (
 	"fmt"
 	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/oscar/internal/docs"
 	"golang.org/x/oscar/internal/github"
@@ -48,18 +51,62 @@ func Restart(lg *slog.Logger, gh *github.Client) {
 }
 
 // cleanTitle should clean the title for indexing.
-// For now we assume the LLM is good enough at Markdown not to bother.
+// For now we assume the LLM is good enough at Markdown not to bother,
+// but we do remove invalid UTF-8 and control characters (see [sanitize]),
+// including any newlines and tabs.
 func cleanTitle(title string) string {
-	// TODO
-	return title
+	return strings.Join(strings.Fields(sanitize(title)), " ")
 }
 
 // cleanBody should clean the body for indexing.
-// For now we assume the LLM is good enough at Markdown not to bother.
+// For now we assume the LLM is good enough at Markdown not to bother,
+// but we do remove invalid UTF-8 and control characters (see [sanitize]).
 // In the future we may want to make various changes like inlining
 // the programs associated with playground URLs,
 // and we may also want to remove any HTML tags from the Markdown.
 func cleanBody(body string) string {
-	// TODO
-	return body
+	return sanitize(body)
+}
+
+// sanitize returns s with invalid UTF-8 replaced by U+FFFD,
+// ANSI terminal escape sequences (as found in pasted logs) removed,
+// and all other control characters except newline and tab removed.
+// The raw text is still available from the issue in the GitHub database;
+// only the document text is sanitized.
+func sanitize(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\x1b' && i+1 < len(s) && s[i+1] == '[':
+			// CSI sequence: ESC [, parameter and intermediate bytes
+			// in 0x20-0x3F, then a final byte in 0x40-0x7E.
+			// An unterminated sequence ends at the first other byte,
+			// which is kept.
+			j := i + 2
+			for j < len(s) && 0x20 <= s[j] && s[j] <= 0x3f {
+				j++
+			}
+			if j < len(s) && 0x40 <= s[j] && s[j] <= 0x7e {
+				i = j // skip final byte too
+			} else {
+				i = j - 1
+			}
+		case c == '\n' || c == '\t':
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			// drop
+		default:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if unicode.IsControl(r) {
+				// C1 controls like U+009B (single-character CSI).
+				i += size - 1
+				continue
+			}
+			b.WriteString(s[i : i+size])
+			i += size - 1
+		}
+	}
+	return b.String()
 }
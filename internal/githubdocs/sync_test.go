@@ -85,3 +85,31 @@ var (
 	md1Title = "Support Github Emojis"
 	md1Text  = "This is an issue for supporting github emojis, such as `:smile:` for \n😄 . There's a github page that gives a mapping of emojis to image \nfile names that we can parse the hex representation out of here: \nhttps://api.github.com/emojis.\n"
 )
+
+var cleanTests = []struct {
+	in    string
+	title string
+	body  string
+}{
+	{"plain text", "plain text", "plain text"},
+	{"line one\nline two\n\tindented", "line one line two indented", "line one\nline two\n\tindented"},
+	{"bad \xff\xfe utf-8", "bad � utf-8", "bad � utf-8"},
+	{"\x1b[31mred\x1b[0m and \x1b[1;32mgreen\x1b[m", "red and green", "red and green"},
+	{"bell\a back\bspace\r\n", "bell backspace", "bell backspace\n"},
+	{"c1 \u009b31m control", "c1 31m control", "c1 31m control"},
+	{"unterminated \x1b[31", "unterminated", "unterminated "},
+	{"line1 \x1b[31\nline2", "line1 line2", "line1 \nline2"},
+	{"x\x1b[日本語 text m end", "x日本語 text m end", "x日本語 text m end"},
+	{"日本語 ok", "日本語 ok", "日本語 ok"},
+}
+
+func TestClean(t *testing.T) {
+	for _, tt := range cleanTests {
+		if title := cleanTitle(tt.in); title != tt.title {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tt.in, title, tt.title)
+		}
+		if body := cleanBody(tt.in); body != tt.body {
+			t.Errorf("cleanBody(%q) = %q, want %q", tt.in, body, tt.body)
+		}
+	}
+}
@@ -6,6 +6,7 @@
 package related
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -112,6 +113,16 @@ func (p *Poster) SkipTitleSuffix(suffix string) {
 	})
 }
 
+// SkipAuthor configures the Poster to skip issues opened by the
+// GitHub user with the given login.
+// In particular, the Poster should skip issues opened by its own
+// GitHub account, so that it never reacts to its own activity.
+func (p *Poster) SkipAuthor(login string) {
+	p.ignores = append(p.ignores, func(issue *github.Issue) bool {
+		return issue.User.Login == login
+	})
+}
+
 // EnableProject enables the Poster to post on issues in the given GitHub project (for example "golang/go").
 // See also [Poster.EnablePosts], which must also be called to post anything to GitHub.
 func (p *Poster) EnableProject(project string) {
@@ -136,7 +147,7 @@ func (p *Poster) deletePosted() {
 // Run skips closed issues, and it also skips pull requests.
 //
 // For each issue that matches the configured posting constraints
-// (see [Poster.EnableProject], [Poster.SetTimeLimit], [Poster.IgnoreBodyContains], [Poster.IgnoreTitlePrefix], and [Poster.IgnoreTitleSuffix]),
+// (see [Poster.EnableProject], [Poster.SetTimeLimit], [Poster.IgnoreBodyContains], [Poster.IgnoreTitlePrefix], [Poster.IgnoreTitleSuffix], and [Poster.SkipAuthor]),
 // Run computes an embedding of the issue body text (ignoring comments)
 // and looks in the vector database for other documents (currently only issues)
 // that are aligned closely enough with that body text
@@ -150,7 +161,7 @@ func (p *Poster) deletePosted() {
 //
 // When [Poster.EnablePosts] has not been called, Run only logs the comments it would post.
 // Future calls to Run will reprocess the same issues and re-log the same comments.
-func (p *Poster) Run() {
+func (p *Poster) Run(ctx context.Context) {
 	p.slog.Info("related.Poster start", "name", p.name)
 	defer p.slog.Info("related.Poster end", "name", p.name)
 
@@ -236,16 +247,27 @@ Watcher:
 			continue
 		}
 
-		if err := p.github.PostIssueComment(issue, &github.IssueCommentChanges{Body: comment.String()}); err != nil {
+		// Hold the lock on the posted key while posting, so that
+		// another Poster running at the same time (for example,
+		// one triggered by a webhook) does not post to the issue too.
+		// It must check again after acquiring the lock.
+		p.db.Lock(string(posted))
+		if _, ok := p.db.Get(posted); ok {
+			p.db.Unlock(string(posted))
+			continue
+		}
+		if err := p.github.PostIssueComment(ctx, issue, &github.IssueCommentChanges{Body: comment.String()}); err != nil {
+			p.db.Unlock(string(posted))
 			p.slog.Error("PostIssueComment", "issue", e.Issue, "err", err)
 			continue
 		}
 		p.db.Set(posted, nil)
+		p.db.Flush()
+		p.db.Unlock(string(posted))
 		p.watcher.MarkOld(e.DBTime)
 
 		// Flush immediately to make sure we don't re-post if interrupted later in the loop.
 		p.watcher.Flush()
-		p.db.Flush()
 	}
 }
 
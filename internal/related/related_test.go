@@ -5,10 +5,12 @@
 package related
 
 import (
+	"context"
 	"fmt"
 	"maps"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -23,6 +25,7 @@ import (
 )
 
 func Test(t *testing.T) {
+	ctx := context.Background()
 	lg := testutil.Slogger(t)
 	db := storage.MemDB()
 	gh := github.New(lg, db, nil, nil)
@@ -39,12 +42,12 @@ func Test(t *testing.T) {
 	p := New(lg, db, gh, vdb, dc, "postname")
 	p.EnableProject("rsc/markdown")
 	p.SetTimeLimit(time.Time{})
-	p.Run()
+	p.Run(ctx)
 	checkEdits(t, gh.Testing().Edits(), nil)
 	gh.Testing().ClearEdits()
 
 	p.EnablePosts()
-	p.Run()
+	p.Run(ctx)
 	checkEdits(t, gh.Testing().Edits(), map[int64]string{13: post13, 19: post19})
 	gh.Testing().ClearEdits()
 
@@ -52,11 +55,11 @@ func Test(t *testing.T) {
 	p.EnableProject("rsc/markdown")
 	p.SetTimeLimit(time.Time{})
 	p.EnablePosts()
-	p.Run()
+	p.Run(ctx)
 	checkEdits(t, gh.Testing().Edits(), nil)
 	gh.Testing().ClearEdits()
 
-	for i := range 4 {
+	for i := range 5 {
 		p := New(lg, db, gh, vdb, dc, "postnameloop."+fmt.Sprint(i))
 		p.EnableProject("rsc/markdown")
 		p.SetTimeLimit(time.Time{})
@@ -70,10 +73,12 @@ func Test(t *testing.T) {
 		case 3:
 			p.SkipBodyContains("For example, this heading")
 			p.SkipBodyContains("ZZZ")
+		case 4:
+			p.SkipAuthor("adonovan")
 		}
 		p.EnablePosts()
 		p.deletePosted()
-		p.Run()
+		p.Run(ctx)
 		checkEdits(t, gh.Testing().Edits(), map[int64]string{13: post13})
 		gh.Testing().ClearEdits()
 	}
@@ -84,7 +89,7 @@ func Test(t *testing.T) {
 	p.SetTimeLimit(time.Time{})
 	p.EnablePosts()
 	p.deletePosted()
-	p.Run()
+	p.Run(ctx)
 	checkEdits(t, gh.Testing().Edits(), nil)
 	gh.Testing().ClearEdits()
 
@@ -94,7 +99,7 @@ func Test(t *testing.T) {
 	p.SetTimeLimit(time.Date(2222, 1, 1, 1, 1, 1, 1, time.UTC))
 	p.EnablePosts()
 	p.deletePosted()
-	p.Run()
+	p.Run(ctx)
 	checkEdits(t, gh.Testing().Edits(), nil)
 	gh.Testing().ClearEdits()
 
@@ -105,12 +110,44 @@ func Test(t *testing.T) {
 	p.SetTimeLimit(time.Time{})
 	p.EnablePosts()
 	p.deletePosted()
-	p.Run()
+	p.Run(ctx)
 	checkEdits(t, gh.Testing().Edits(), nil)
 	gh.Testing().ClearEdits()
 
 }
 
+func TestConcurrentPosters(t *testing.T) {
+	ctx := context.Background()
+	lg := testutil.Slogger(t)
+	db := storage.MemDB()
+	gh := github.New(lg, db, nil, nil)
+	gh.Testing().LoadTxtar("../testdata/markdown.txt")
+	gh.Testing().LoadTxtar("../testdata/rsctmp.txt")
+
+	dc := docs.New(db)
+	githubdocs.Sync(lg, dc, gh)
+
+	vdb := storage.MemVectorDB(db, lg, "vecs")
+	embeddocs.Sync(lg, vdb, llm.QuoteEmbedder(), dc)
+
+	// Two Posters with different names see the same new issues,
+	// but each issue must only be posted to once.
+	var wg sync.WaitGroup
+	for i := range 2 {
+		p := New(lg, db, gh, vdb, dc, "concurrent."+fmt.Sprint(i))
+		p.EnableProject("rsc/markdown")
+		p.SetTimeLimit(time.Time{})
+		p.EnablePosts()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Run(ctx)
+		}()
+	}
+	wg.Wait()
+	checkEdits(t, gh.Testing().Edits(), map[int64]string{13: post13, 19: post19})
+}
+
 func checkEdits(t *testing.T, edits []*github.TestingEdit, want map[int64]string) {
 	t.Helper()
 	for _, e := range edits {
@@ -86,3 +86,32 @@ func openNetrc(file string) ReadOnlyMap {
 	}
 	return m
 }
+
+// A Dir is a read-only [DB] that stores each secret in its own file
+// in the named directory, with the file name as the secret name.
+// This is the layout used by many container systems, such as
+// Kubernetes, for secrets mounted as volumes.
+//
+// Get reads the file on each call, so that rotated secrets
+// take effect without restarting the program.
+// Leading and trailing white space (typically a final newline)
+// is removed from the secret.
+// Calling [Set] panics.
+type Dir string
+
+// Get returns the named secret.
+func (d Dir) Get(name string) (secret string, ok bool) {
+	if !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+	data, err := os.ReadFile(filepath.Join(string(d), name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+// Set panics.
+func (d Dir) Set(name, secret string) {
+	panic("read-only secrets")
+}
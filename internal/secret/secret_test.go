@@ -55,3 +55,41 @@ func TestEmpty(t *testing.T) {
 		t.Errorf("Set did not panic")
 	}()
 }
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("example.com", "u1:p1\n")
+	if err := os.WriteFile(filepath.Join(filepath.Dir(dir), "outside"), []byte("no"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	db := Dir(dir)
+	for _, name := range []string{"missing", "", ".", "../outside", "sub/example.com"} {
+		if secret, ok := db.Get(name); secret != "" || ok != false {
+			t.Errorf("Get(%q) = %q, %v, want %q, %v", name, secret, ok, "", false)
+		}
+	}
+
+	if secret, ok := db.Get("example.com"); secret != "u1:p1" || ok != true {
+		t.Errorf("Get(example.com) = %q, %v, want %q, %v", secret, ok, "u1:p1", true)
+	}
+
+	// Rotated secrets are seen immediately.
+	write("example.com", "u2:p2")
+	if secret, ok := db.Get("example.com"); secret != "u2:p2" || ok != true {
+		t.Errorf("Get(example.com) after rotation = %q, %v, want %q, %v", secret, ok, "u2:p2", true)
+	}
+
+	func() {
+		defer func() {
+			recover()
+		}()
+		db.Set("name", "value")
+		t.Errorf("Set did not panic")
+	}()
+}